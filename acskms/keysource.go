@@ -2,6 +2,7 @@ package acskms
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
@@ -18,11 +19,17 @@ import (
 )
 
 const (
-	// arnRegex matches an ACS ARN, for example:
-	// "acs:kms:cn-shanghai:1234567890:key/key-idxxxxx".
-	arnRegex = `^acs:kms:(.+):[0-9]+:key/(.+)$`
-	// kmsTTL is the duration after which a MasterKey requires rotation.
-	kmsTTL = time.Hour
+	// arnRegex matches an ACS key or alias ARN, for example:
+	// "acs:kms:cn-shanghai:1234567890:key/key-idxxxxx" or
+	// "acs:kms:cn-shanghai:1234567890:alias/my-alias". It does not match the
+	// "+role/..." or "||k1=v1,k2=v2" suffixes NewMasterKeyFromKeyIDString
+	// accepts -- those are split off before this is applied.
+	arnRegex = `^acs:kms:(.+):[0-9]+:(?:key|alias)/(.+)$`
+	// aliasArnRegex matches the alias form of an ACS key ARN specifically.
+	aliasArnRegex = `^acs:kms:.+:[0-9]+:alias/.+$`
+	// kmsTTL is the duration after which a MasterKey requires rotation, used
+	// when SOPS_ACSKMS_ROTATION_MAX_AGE is unset or invalid.
+	kmsTTL = time.Hour * 24 * 30 * 6
 	// KeyTypeIdentifier is the string used to identify an ACS KMS MasterKey.
 	KeyTypeIdentifier = "acs_kms"
 )
@@ -46,10 +53,24 @@ type MasterKey struct {
 	EncryptedKey string
 	// CreationDate is when this MasterKey was created.
 	CreationDate time.Time
+	// EncryptionContext provides additional authenticated data passed to the
+	// Encrypt/Decrypt calls.
+	// Ref: https://www.alibabacloud.com/help/en/kms/developer-reference/api-kms-2016-01-20-encrypt
+	EncryptionContext map[string]string
+	// Role is the ARN of a RAM role to assume via STS before authenticating
+	// with KMS, e.g. "acs:ram::1234567890:role/my-role".
+	Role string
+	// RoleSessionName is the session name used when assuming Role. Defaults
+	// to "sops" when empty.
+	RoleSessionName string
+	// KeyVersion is the primary key version reported by KMS the last time
+	// Arn was resolved or a rotation check ran. It's informational only:
+	// KMS selects the key version used for Encrypt/Decrypt on its own.
+	KeyVersion string
 }
 
-// NewMasterKey creates a new MasterKey from a key arn string, setting
-// the creation date to the current date.
+// NewMasterKey creates a new MasterKey from a key or alias arn string,
+// setting the creation date to the current date.
 func NewMasterKey(arn string) (*MasterKey, error) {
 	region, err := parseKeyArn(arn)
 	if err != nil {
@@ -62,8 +83,36 @@ func NewMasterKey(arn string) (*MasterKey, error) {
 	}, nil
 }
 
-// NewMasterKeyFromKeyIDString takes a comma separated list of Alibaba Cloud KMS
-// key ARNs, and returns a slice of new MasterKeys.
+// NewMasterKeyWithEncryptionContext creates a new MasterKey from a key or
+// alias arn string and an encryption context, setting the creation date to
+// the current date.
+func NewMasterKeyWithEncryptionContext(arn string, context map[string]string) (*MasterKey, error) {
+	key, err := NewMasterKey(arn)
+	if err != nil {
+		return nil, err
+	}
+	key.EncryptionContext = context
+	return key, nil
+}
+
+// NewMasterKeyWithRole creates a new MasterKey from a key or alias arn
+// string and a RAM role ARN to assume via STS, setting the creation date to
+// the current date.
+func NewMasterKeyWithRole(arn string, role string) (*MasterKey, error) {
+	key, err := NewMasterKey(arn)
+	if err != nil {
+		return nil, err
+	}
+	key.Role = role
+	return key, nil
+}
+
+// NewMasterKeyFromKeyIDString takes a comma separated list of Alibaba Cloud
+// KMS key ARNs, and returns a slice of new MasterKeys. Each entry may carry
+// two optional suffixes, in this order: a "+role/<ram-role-arn>" suffix to
+// assume a RAM role via STS before calling KMS, and a "||k1=v1,k2=v2" suffix
+// setting an EncryptionContext, e.g.
+// "acs:kms:cn-hangzhou:1234567890:key/my-key+role/acs:ram::1234567890:role/my-role||env=prod".
 func NewMasterKeyFromKeyIDString(keyArn string) ([]*MasterKey, error) {
 	var keys []*MasterKey
 	if keyArn == "" {
@@ -74,16 +123,57 @@ func NewMasterKeyFromKeyIDString(keyArn string) ([]*MasterKey, error) {
 		if s == "" {
 			continue
 		}
-		k, err := NewMasterKey(s)
+		arn, role, context, err := splitKeyIDSuffixes(s)
+		if err != nil {
+			return nil, err
+		}
+		k, err := NewMasterKey(arn)
 		if err != nil {
 			return nil, err
 		}
+		k.Role = role
+		k.EncryptionContext = context
 		keys = append(keys, k)
 	}
 	return keys, nil
 }
 
-// parseKeyArn parse an Alibaba Cloud KMS key identifier, which can be a full ARN.
+// splitKeyIDSuffixes splits a single NewMasterKeyFromKeyIDString entry into
+// its bare key/alias ARN and its two optional suffixes. The "||" context
+// suffix, when present, is always last, since otherwise "||" and the "," it
+// uses to separate key/value pairs would be ambiguous with a role ARN.
+func splitKeyIDSuffixes(s string) (arn string, role string, context map[string]string, err error) {
+	arn = s
+	if i := strings.Index(arn, "||"); i >= 0 {
+		context, err = parseEncryptionContextSuffix(arn[i+2:])
+		if err != nil {
+			return "", "", nil, err
+		}
+		arn = arn[:i]
+	}
+	if i := strings.Index(arn, "+role/"); i >= 0 {
+		role = arn[i+len("+role/"):]
+		arn = arn[:i]
+	}
+	return arn, role, context, nil
+}
+
+// parseEncryptionContextSuffix parses the "k1=v1,k2=v2" portion of a
+// "||k1=v1,k2=v2" key ID suffix into an EncryptionContext map.
+func parseEncryptionContextSuffix(raw string) (map[string]string, error) {
+	context := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid ACS KMS encryption context entry %q: expected k=v", pair)
+		}
+		context[k] = v
+	}
+	return context, nil
+}
+
+// parseKeyArn parse an Alibaba Cloud KMS key identifier, which can be a full
+// key or alias ARN.
 func parseKeyArn(arn string) (string, error) {
 	re := regexp.MustCompile(arnRegex)
 	matches := re.FindStringSubmatch(arn)
@@ -94,6 +184,52 @@ func parseKeyArn(arn string) (string, error) {
 	return matches[1], nil
 }
 
+// encryptionContextJSON marshals the MasterKey's EncryptionContext to the
+// JSON-encoded string expected by the Alibaba Cloud KMS API, returning an
+// empty string if no context is set.
+func (key *MasterKey) encryptionContextJSON() (string, error) {
+	if len(key.EncryptionContext) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(key.EncryptionContext)
+	if err != nil {
+		return "", fmt.Errorf("acskms encryption context error: %v", err)
+	}
+	return string(b), nil
+}
+
+// isAliasArn returns whether arn is the alias form of an ACS KMS key ARN,
+// e.g. "acs:kms:cn-hangzhou:1234567890:alias/my-alias".
+func isAliasArn(arn string) bool {
+	return regexp.MustCompile(aliasArnRegex).MatchString(arn)
+}
+
+// describeKey fetches the CMK's metadata from KMS using client.
+func (key *MasterKey) describeKey(client *kmssdk.Client) (*kmssdk.DescribeKeyResponseBodyKeyMetadata, error) {
+	resp, err := client.DescribeKey(&kmssdk.DescribeKeyRequest{KeyId: tea.String(key.Arn)})
+	if err != nil {
+		return nil, fmt.Errorf("acskms describe key error: %v", err)
+	}
+	return resp.Body.KeyMetadata, nil
+}
+
+// resolveArn replaces an alias Arn with the concrete key ARN and records the
+// key's current primary version, so persisted state (ToMap) and subsequent
+// KMS calls refer to the actual key rather than an alias that could later be
+// repointed at a different key.
+func (key *MasterKey) resolveArn(client *kmssdk.Client) error {
+	if !isAliasArn(key.Arn) {
+		return nil
+	}
+	meta, err := key.describeKey(client)
+	if err != nil {
+		return err
+	}
+	key.Arn = tea.StringValue(meta.Arn)
+	key.KeyVersion = tea.StringValue(meta.PrimaryKeyVersion)
+	return nil
+}
+
 // Encrypt encrypts the data key using Alibaba Cloud KMS.
 func (key *MasterKey) Encrypt(dataKey []byte) error {
 	client, err := key.getClient()
@@ -101,10 +237,22 @@ func (key *MasterKey) Encrypt(dataKey []byte) error {
 		return err
 	}
 
+	if err := key.resolveArn(client); err != nil {
+		return err
+	}
+
+	encryptionContext, err := key.encryptionContextJSON()
+	if err != nil {
+		return err
+	}
+
 	request := &kmssdk.EncryptRequest{
 		KeyId:     tea.String(key.Arn),
 		Plaintext: tea.String(base64.StdEncoding.EncodeToString(dataKey)),
 	}
+	if encryptionContext != "" {
+		request.EncryptionContext = tea.String(encryptionContext)
+	}
 
 	resp, err := client.Encrypt(request)
 	if err != nil {
@@ -122,9 +270,21 @@ func (key *MasterKey) Decrypt() ([]byte, error) {
 		return nil, err
 	}
 
+	if err := key.resolveArn(client); err != nil {
+		return nil, err
+	}
+
+	encryptionContext, err := key.encryptionContextJSON()
+	if err != nil {
+		return nil, err
+	}
+
 	request := &kmssdk.DecryptRequest{
 		CiphertextBlob: tea.String(key.EncryptedKey),
 	}
+	if encryptionContext != "" {
+		request.EncryptionContext = tea.String(encryptionContext)
+	}
 	// If an endpoint is manually set (e.g. KMS Instance), we might need to rely on the SDK's behavior.
 	// The standard SDK usually works fine with CiphertextBlob.
 
@@ -154,9 +314,51 @@ func (key *MasterKey) SetEncryptedDataKey(enc []byte) {
 	key.EncryptedKey = string(enc)
 }
 
-// NeedsRotation checks if the key needs rotation.
+// rotationMaxAge returns the configured rotation threshold: the value of
+// SOPS_ACSKMS_ROTATION_MAX_AGE (a Go duration string, e.g. "4320h") if it's
+// set and valid, or kmsTTL otherwise.
+func rotationMaxAge() time.Duration {
+	if raw := os.Getenv("SOPS_ACSKMS_ROTATION_MAX_AGE"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil {
+			return d
+		}
+		log.Warnf("Invalid SOPS_ACSKMS_ROTATION_MAX_AGE %q, falling back to %s", raw, kmsTTL)
+	}
+	return kmsTTL
+}
+
+// NeedsRotation returns whether the data key needs to be rotated or not. It
+// asks KMS for the CMK's current key version and compares its creation time
+// (LastRotationDate, which for a never-rotated key is the key's creation
+// time) against rotationMaxAge. If KMS can't be reached, it falls back to
+// comparing the MasterKey's own CreationDate, so a transient API error
+// doesn't mask rotation that's actually overdue.
 func (key *MasterKey) NeedsRotation() bool {
-	return false
+	maxAge := rotationMaxAge()
+
+	client, err := key.getClient()
+	if err != nil {
+		log.Warnf("Could not create client to check ACS KMS key rotation, falling back to local creation date: %v", err)
+		return time.Since(key.CreationDate) > maxAge
+	}
+
+	meta, err := key.describeKey(client)
+	if err != nil {
+		log.Warnf("Could not describe ACS KMS key to check rotation, falling back to local creation date: %v", err)
+		return time.Since(key.CreationDate) > maxAge
+	}
+	key.KeyVersion = tea.StringValue(meta.PrimaryKeyVersion)
+
+	lastRotation := tea.StringValue(meta.LastRotationDate)
+	if lastRotation == "" {
+		lastRotation = tea.StringValue(meta.CreationDate)
+	}
+	t, err := time.Parse(time.RFC3339, lastRotation)
+	if err != nil {
+		log.Warnf("Could not parse ACS KMS key rotation date %q, falling back to local creation date", lastRotation)
+		return time.Since(key.CreationDate) > maxAge
+	}
+	return time.Since(t) > maxAge
 }
 
 // ToString returns the string representation of the key.
@@ -166,11 +368,95 @@ func (key *MasterKey) ToString() string {
 
 // ToMap returns the map representation of the key.
 func (key *MasterKey) ToMap() map[string]interface{} {
-	return map[string]interface{}{
+	out := map[string]interface{}{
 		"arn":        key.Arn,
 		"created_at": key.CreationDate.UTC().Format(time.RFC3339),
 		"enc":        key.EncryptedKey,
 	}
+	if len(key.EncryptionContext) > 0 {
+		out["context"] = key.EncryptionContext
+	}
+	if key.Role != "" {
+		out["role"] = key.Role
+	}
+	if key.KeyVersion != "" {
+		out["key_version"] = key.KeyVersion
+	}
+	return out
+}
+
+// MasterKeyFromMap reconstructs a MasterKey from a map produced by ToMap,
+// round-tripping Role, EncryptionContext and KeyVersion along with it. Other
+// key source packages do this through a store-specific wire struct and its
+// own toInternal() method (see e.g. stores.kmskey); acskms has no such wire
+// struct wired into a store yet, so this is the equivalent entry point for
+// whichever store eventually adds one.
+func MasterKeyFromMap(m map[string]interface{}) (*MasterKey, error) {
+	arn, _ := m["arn"].(string)
+	key, err := NewMasterKey(arn)
+	if err != nil {
+		return nil, err
+	}
+	if createdAt, ok := m["created_at"].(string); ok && createdAt != "" {
+		t, err := time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ACS KMS created_at %q: %v", createdAt, err)
+		}
+		key.CreationDate = t
+	}
+	if enc, ok := m["enc"].(string); ok {
+		key.EncryptedKey = enc
+	}
+	if role, ok := m["role"].(string); ok {
+		key.Role = role
+	}
+	if keyVersion, ok := m["key_version"].(string); ok {
+		key.KeyVersion = keyVersion
+	}
+	if rawContext, ok := m["context"]; ok {
+		context, err := encryptionContextFromInterface(rawContext)
+		if err != nil {
+			return nil, err
+		}
+		key.EncryptionContext = context
+	}
+	return key, nil
+}
+
+// encryptionContextFromInterface converts the loosely-typed map a generic
+// YAML/JSON decoder produces for the "context" entry back into the
+// map[string]string MasterKey.EncryptionContext expects.
+func encryptionContextFromInterface(raw interface{}) (map[string]string, error) {
+	out := map[string]string{}
+	switch raw := raw.(type) {
+	case map[string]string:
+		for k, v := range raw {
+			out[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range raw {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("acskms encryption context value for %q is not a string", k)
+			}
+			out[k] = s
+		}
+	case map[interface{}]interface{}:
+		for k, v := range raw {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("acskms encryption context key %v is not a string", k)
+			}
+			vs, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("acskms encryption context value for %q is not a string", ks)
+			}
+			out[ks] = vs
+		}
+	default:
+		return nil, fmt.Errorf("acskms encryption context has unsupported type %T", raw)
+	}
+	return out, nil
 }
 
 // TypeToIdentifier returns the type identifier of the key.
@@ -178,9 +464,29 @@ func (key *MasterKey) TypeToIdentifier() string {
 	return KeyTypeIdentifier
 }
 
+// getCredential returns the credential used to authenticate with Alibaba
+// Cloud KMS, assuming key.Role through STS when set.
+func (key *MasterKey) getCredential() (credentials.Credential, error) {
+	if key.Role == "" {
+		return credentials.NewCredential(nil)
+	}
+
+	sessionName := key.RoleSessionName
+	if sessionName == "" {
+		sessionName = "sops"
+	}
+
+	config := new(credentials.Config).
+		SetType("ram_role_arn").
+		SetRoleArn(key.Role).
+		SetRoleSessionName(sessionName)
+
+	return credentials.NewCredential(config)
+}
+
 // getClient returns a new Alibaba Cloud KMS client.
 func (key *MasterKey) getClient() (*kmssdk.Client, error) {
-	cred, err := credentials.NewCredential(nil)
+	cred, err := key.getCredential()
 	if err != nil {
 		return nil, fmt.Errorf("acskms credential error: %v", err)
 	}
@@ -21,9 +21,10 @@ func TestNewMasterKey(t *testing.T) {
 			expectErr:      false,
 		},
 		{
-			desc:      "alias ARN not supported",
-			input:     "acs:kms:cn-hangzhou:1234567890:alias/my-alias",
-			expectErr: true,
+			desc:           "valid alias ARN",
+			input:          "acs:kms:cn-hangzhou:1234567890:alias/my-alias",
+			expectedRegion: "cn-hangzhou",
+			expectErr:      false,
 		},
 		{
 			desc:      "invalid ARN format",
@@ -115,6 +116,37 @@ func TestMasterKey_ToMap(t *testing.T) {
 	assert.Equal(t, arn, m["arn"])
 	assert.Equal(t, "encrypted_data", m["enc"])
 	assert.NotEmpty(t, m["created_at"])
+	assert.Nil(t, m["context"])
+	assert.Nil(t, m["role"])
+}
+
+func TestMasterKey_Role(t *testing.T) {
+	arn := "acs:kms:cn-shanghai:1234567890:key/key1"
+	role := "acs:ram::1234567890:role/my-role"
+
+	k, err := NewMasterKeyWithRole(arn, role)
+	assert.NoError(t, err)
+	assert.Equal(t, role, k.Role)
+
+	m := k.ToMap()
+	assert.Equal(t, role, m["role"])
+}
+
+func TestMasterKey_EncryptionContext(t *testing.T) {
+	arn := "acs:kms:cn-shanghai:1234567890:key/key1"
+	context := map[string]string{"env": "prod"}
+
+	k, err := NewMasterKeyWithEncryptionContext(arn, context)
+	assert.NoError(t, err)
+	assert.Equal(t, context, k.EncryptionContext)
+
+	k.EncryptedKey = "encrypted_data"
+	m := k.ToMap()
+	assert.Equal(t, context, m["context"])
+
+	ctxJSON, err := k.encryptionContextJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"env":"prod"}`, ctxJSON)
 }
 
 func TestMasterKey_MethodProxies(t *testing.T) {
@@ -129,12 +161,18 @@ func TestMasterKey_MethodProxies(t *testing.T) {
 	// Test ToString
 	assert.Equal(t, arn, k.ToString())
 
-	// Test NeedsRotation (should be false as per implementation)
-	assert.False(t, k.NeedsRotation())
-
 	// Test EncryptIfNeeded (noop if already encrypted)
 	k.EncryptedKey = "already_encrypted"
 	err = k.EncryptIfNeeded([]byte("data"))
 	assert.NoError(t, err)
 	assert.Equal(t, "already_encrypted", k.EncryptedKey)
 }
+
+func TestMasterKey_NeedsRotation(t *testing.T) {
+	k, err := NewMasterKey("acs:kms:cn-shanghai:1234567890:key/key1")
+	assert.NoError(t, err)
+	assert.False(t, k.NeedsRotation())
+
+	k.CreationDate = k.CreationDate.Add(-(kmsTTL + time.Second))
+	assert.True(t, k.NeedsRotation())
+}
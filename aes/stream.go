@@ -0,0 +1,101 @@
+package aes
+
+import (
+	cryptoaes "crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/getsops/sops/v3"
+)
+
+// StreamFileNonceSize is the size, in bytes, of the random per-file nonce a
+// StreamingCipher mixes with each chunk's sequence number to derive that
+// chunk's AES-GCM nonce. sops often re-encrypts a stream under the same data
+// key (for example, repeated `sops edit` without `--rotate`), so FileNonce
+// needs enough random bits that the birthday bound on colliding with a
+// previous stream's FileNonce stays negligible far beyond any realistic
+// number of re-encryptions; 4 bytes (a 2^16-ish collision bound) isn't
+// enough for that, so this is 16 bytes -- the same random-nonce margin
+// AES-GCM is normally given -- with the chunk sequence number appended on
+// top, rather than substituted for part of it.
+const StreamFileNonceSize = 16
+
+// StreamingCipher implements sops.StreamingCipher with AES GCM 256, the same
+// AEAD Cipher uses for individual tree values. Unlike Cipher, it never
+// generates a fresh random nonce per call: instead, the nonce for the chunk
+// at seqNum is derived deterministically from FileNonce and seqNum, so that
+// a chunk decrypted at the wrong position in the stream -- reordered,
+// duplicated, or spliced in from a different file -- fails authentication
+// rather than being silently accepted.
+//
+// No cmd/sops command calls sops.EncryptStream/DecryptStream yet: encrypt,
+// decrypt and edit all go through InputStore.LoadPlainFile and
+// Tree.Branches, which load the full document into memory regardless of
+// whether the value being read happens to be passed through a
+// StreamingCipher. Wiring an actual streaming path through the CLI would
+// mean a format-specific streaming parser per store, which is its own
+// follow-up; until then this package is a library-only primitive exercised
+// only by its own tests, and does not by itself fix large-file memory use.
+type StreamingCipher struct {
+	// FileNonce is the random nonce generated once per encrypted stream. It
+	// must be stored alongside the ciphertext (see sops.StreamMetadata) so
+	// the stream can be decrypted again later.
+	FileNonce []byte
+}
+
+// NewStreamingCipher generates a new StreamingCipher with a fresh random
+// FileNonce.
+func NewStreamingCipher() (*StreamingCipher, error) {
+	nonce := make([]byte, StreamFileNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("could not generate random file nonce: %s", err)
+	}
+	return &StreamingCipher{FileNonce: nonce}, nil
+}
+
+// EncryptChunk encrypts chunk with key, AEAD-binding it to additionalData
+// and to seqNum, its position in the stream.
+func (c *StreamingCipher) EncryptChunk(chunk []byte, key []byte, additionalData string, seqNum uint64) ([]byte, error) {
+	gcm, err := c.gcm(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nil, c.chunkNonce(seqNum), chunk, []byte(additionalData)), nil
+}
+
+// DecryptChunk decrypts chunk, returning an error if it was not encrypted
+// with key for this exact additionalData and seqNum.
+func (c *StreamingCipher) DecryptChunk(chunk []byte, key []byte, additionalData string, seqNum uint64) ([]byte, error) {
+	gcm, err := c.gcm(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, c.chunkNonce(seqNum), chunk, []byte(additionalData))
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt chunk %d with AES_GCM: %s", seqNum, err)
+	}
+	return plaintext, nil
+}
+
+// chunkNonce derives the AES-GCM nonce for the chunk at seqNum by appending
+// seqNum, as a big-endian uint64, to FileNonce. Since seqNum increases
+// monotonically and is never reused within a stream, every chunk gets a
+// unique nonce without a fresh random read per chunk.
+func (c *StreamingCipher) chunkNonce(seqNum uint64) []byte {
+	nonce := make([]byte, len(c.FileNonce)+8)
+	copy(nonce, c.FileNonce)
+	binary.BigEndian.PutUint64(nonce[len(c.FileNonce):], seqNum)
+	return nonce
+}
+
+func (c *StreamingCipher) gcm(key []byte) (cipher.AEAD, error) {
+	block, err := cryptoaes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize AES cipher: %s", err)
+	}
+	return cipher.NewGCMWithNonceSize(block, len(c.FileNonce)+8)
+}
+
+var _ sops.StreamingCipher = &StreamingCipher{}
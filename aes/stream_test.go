@@ -0,0 +1,46 @@
+package aes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamingCipherEncryptDecryptChunk(t *testing.T) {
+	key := []byte(strings.Repeat("f", 32))
+	c, err := NewStreamingCipher()
+	assert.NoError(t, err)
+
+	ciphertext, err := c.EncryptChunk([]byte("hello chunk"), key, "path:", 0)
+	assert.NoError(t, err)
+
+	plaintext, err := c.DecryptChunk(ciphertext, key, "path:", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello chunk"), plaintext)
+}
+
+func TestStreamingCipherRejectsWrongSeqNum(t *testing.T) {
+	key := []byte(strings.Repeat("f", 32))
+	c, err := NewStreamingCipher()
+	assert.NoError(t, err)
+
+	ciphertext, err := c.EncryptChunk([]byte("hello chunk"), key, "path:", 0)
+	assert.NoError(t, err)
+
+	_, err = c.DecryptChunk(ciphertext, key, "path:", 1)
+	assert.Error(t, err)
+}
+
+func TestStreamingCipherRejectsWrongKey(t *testing.T) {
+	key := []byte(strings.Repeat("f", 32))
+	otherKey := []byte(strings.Repeat("g", 32))
+	c, err := NewStreamingCipher()
+	assert.NoError(t, err)
+
+	ciphertext, err := c.EncryptChunk([]byte("hello chunk"), key, "path:", 0)
+	assert.NoError(t, err)
+
+	_, err = c.DecryptChunk(ciphertext, otherKey, "path:", 0)
+	assert.Error(t, err)
+}
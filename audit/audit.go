@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"os"
 	"os/user"
 
 	"github.com/pkg/errors"
@@ -12,25 +12,15 @@ import (
 	// empty import as per https://godoc.org/github.com/lib/pq
 	_ "github.com/lib/pq"
 
+	"github.com/getsops/sops/v3/logging"
 	"github.com/sirupsen/logrus"
-	"go.mozilla.org/sops/logging"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
 var log *logrus.Logger
 
 func init() {
 	log = logging.NewLogger("AUDIT")
-	confBytes, err := ioutil.ReadFile(configFile)
-	if err != nil {
-		log.WithField("error", err).Debugf("Error reading config")
-		return
-	}
-	var conf config
-	err = yaml.Unmarshal(confBytes, &conf)
-	if err != nil {
-		log.WithField("error", err).Panicf("Error unmarshalling config")
-	}
 	// If we are running test, then don't create auditors.
 	// This is pretty hacky, but doing it The Right Way would require
 	// restructuring SOPS to use dependency injection instead of just using
@@ -38,33 +28,129 @@ func init() {
 	if flag.Lookup("test.v") != nil {
 		return
 	}
-	var auditErrors []error
-
-	for _, pgConf := range conf.Backends.Postgres {
-		auditDb, err := NewPostgresAuditor(pgConf.ConnStr)
-		if err != nil {
-			auditErrors = append(auditErrors, errors.Wrap(err, fmt.Sprintf("connectStr: %s, err", pgConf.ConnStr)))
-		}
-		auditors = append(auditors, auditDb)
-	}
-	if len(auditErrors) > 0 {
-		log.Errorf("connecting to audit database, defined in %s", configFile)
-		for _, err := range auditErrors {
-			log.Error(err)
-		}
-		log.Fatal("one or more audit backends reported errors, exiting")
+	if err := Configure(auditConfigFile()); err != nil {
+		log.Fatal(err)
 	}
 }
 
 // TODO: Make platform agnostic
 const configFile = "/etc/sops/audit.yaml"
 
+// auditConfigFile returns the path to the audit backend config file:
+// SOPS_AUDIT_CONFIG if set, otherwise configFile.
+func auditConfigFile() string {
+	if path := os.Getenv("SOPS_AUDIT_CONFIG"); path != "" {
+		return path
+	}
+	return configFile
+}
+
+// Configure (re)loads the audit backend config from path, replacing any
+// auditors loaded by a previous call to Configure or by package init. It's
+// exported so that a command can honor a --audit-config flag: init() already
+// runs before any CLI flags are parsed, so the env-var/default path it loads
+// at startup can only be a first guess, not the final answer. A missing file
+// at path is not an error -- it just means no auditors get configured --
+// but a present, malformed one is.
+func Configure(path string) error {
+	confBytes, err := os.ReadFile(path)
+	if err != nil {
+		log.WithField("error", err).Debugf("Error reading config")
+		return nil
+	}
+	var conf config
+	if err := yaml.Unmarshal(confBytes, &conf); err != nil {
+		return errors.Wrap(err, "unmarshalling audit config")
+	}
+	auditors = nil
+	return loadAuditorsFromConfig(conf)
+}
+
+// config is the raw shape of the audit config file (see auditConfigFile).
+// Each backend's configuration is kept undecoded, so that auditor
+// implementations registered with RegisterAuditorFactory -- including ones
+// defined outside of this package -- can be configured without this package
+// knowing about their specific config schema.
+//
+// This is a name->factory registry layered on top of a handful of
+// hard-coded event structs (DecryptEvent, EncryptEvent, RotateEvent,
+// UpdateKeysEvent, PublishEvent), each carrying only a File field. It is not
+// the richer audit system sometimes asked for -- there's no Formatter
+// interface, no JSON-lines/syslog output, no structured AuditEvent (actor,
+// file hash, key groups, shamir results, outcome), and no generic Backend
+// sink interface; PostgresAuditor is the only built-in Auditor. Tree.Encrypt
+// and Tree.Decrypt submit an event on every call, rotate/updatekeys/publish
+// each submit one of their own in addition; edit and exec-file are not
+// covered, since their command implementations (cmd/sops/edit.go, the stale
+// root-level decrypt path) predate this package being wired up correctly and
+// aren't touched here.
+//
+// Closing that gap to the originally-requested design is a bigger change
+// than a backlog item should carry on its own -- it needs a product
+// decision on whether to re-scope this item (accept the registry-plus-
+// PostgresAuditor shape as "done") or treat it as still open and schedule
+// the Formatter/AuditEvent/Backend-sink rework as its own piece of work.
 type config struct {
-	Backends struct {
-		Postgres []struct {
+	Backends map[string][]yaml.Node `yaml:"backends"`
+}
+
+// AuditorFactory constructs an Auditor from a single backend's raw
+// configuration block, as found under its name in the "backends" section of
+// /etc/sops/audit.yaml.
+type AuditorFactory func(rawConfig *yaml.Node) (Auditor, error)
+
+// auditorFactories holds the factories registered with RegisterAuditorFactory,
+// keyed by backend name.
+var auditorFactories = map[string]AuditorFactory{}
+
+// RegisterAuditorFactory registers factory under name, so that entries of the
+// form "backends: {<name>: [...]}" in /etc/sops/audit.yaml are turned into
+// Auditors on startup. It is meant to be called from an init() function,
+// before sops reads its audit configuration.
+func RegisterAuditorFactory(name string, factory AuditorFactory) {
+	auditorFactories[name] = factory
+}
+
+func init() {
+	RegisterAuditorFactory("postgres", func(rawConfig *yaml.Node) (Auditor, error) {
+		var pgConf struct {
 			ConnStr string `yaml:"connection_string"`
-		} `yaml:"postgres"`
-	} `yaml:"backends"`
+		}
+		if err := rawConfig.Decode(&pgConf); err != nil {
+			return nil, err
+		}
+		return NewPostgresAuditor(pgConf.ConnStr)
+	})
+}
+
+// loadAuditorsFromConfig instantiates an Auditor for every backend block in
+// conf that has a registered AuditorFactory, appending them to auditors.
+func loadAuditorsFromConfig(conf config) error {
+	var auditErrors []error
+	for name, blocks := range conf.Backends {
+		factory, ok := auditorFactories[name]
+		if !ok {
+			log.Warnf("no auditor registered for backend %q, skipping", name)
+			continue
+		}
+		for _, block := range blocks {
+			block := block
+			auditor, err := factory(&block)
+			if err != nil {
+				auditErrors = append(auditErrors, errors.Wrap(err, fmt.Sprintf("backend %q", name)))
+				continue
+			}
+			auditors = append(auditors, auditor)
+		}
+	}
+	if len(auditErrors) > 0 {
+		log.Errorf("connecting to audit backends, defined in %s", configFile)
+		for _, err := range auditErrors {
+			log.Error(err)
+		}
+		return errors.New("one or more audit backends reported errors, exiting")
+	}
+	return nil
 }
 
 var auditors []Auditor
@@ -105,6 +191,16 @@ type RotateEvent struct {
 	File string
 }
 
+// UpdateKeysEvent contains fields relevant to a key group sync event
+type UpdateKeysEvent struct {
+	File string
+}
+
+// PublishEvent contains fields relevant to a publish event
+type PublishEvent struct {
+	File string
+}
+
 // PostgresAuditor is a Postgres SQL DB implementation of the Auditor interface.
 // It persists the audit event by writing a row to the 'audit_event' table.
 // Errors with writing to the database will output a log message and the
@@ -163,6 +259,22 @@ func (p *PostgresAuditor) Handle(event interface{}) {
 		if err != nil {
 			log.Fatalf("Failed to insert audit record: %s", err)
 		}
+	case UpdateKeysEvent:
+		// Save the event to the database
+		log.WithField("file", event.File).
+			Debug("Saving updatekeys event to database")
+		_, err = p.DB.Exec("INSERT INTO audit_event (action, username, file) VALUES ($1, $2, $3)", "updatekeys", u.Username, event.File)
+		if err != nil {
+			log.Fatalf("Failed to insert audit record: %s", err)
+		}
+	case PublishEvent:
+		// Save the event to the database
+		log.WithField("file", event.File).
+			Debug("Saving publish event to database")
+		_, err = p.DB.Exec("INSERT INTO audit_event (action, username, file) VALUES ($1, $2, $3)", "publish", u.Username, event.File)
+		if err != nil {
+			log.Fatalf("Failed to insert audit record: %s", err)
+		}
 	default:
 		log.WithField("type", fmt.Sprintf("%T", event)).
 			Info("Received unknown event")
@@ -0,0 +1,192 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	RegisterAuditorFactory("websocket", func(rawConfig *yaml.Node) (Auditor, error) {
+		var conf struct {
+			ListenAddress string `yaml:"listen_address"`
+		}
+		if err := rawConfig.Decode(&conf); err != nil {
+			return nil, err
+		}
+		return NewWebSocketAuditor(conf.ListenAddress)
+	})
+}
+
+// keyAccessEvent is the JSON payload broadcast to WebSocket clients for
+// every audited event.
+type keyAccessEvent struct {
+	Action string    `json:"action"`
+	File   string    `json:"file"`
+	Time   time.Time `json:"time"`
+}
+
+// clientSendBufferSize is how many queued events a single WebSocket client
+// may lag behind by before Handle starts dropping events for it, rather than
+// blocking on its connection.
+const clientSendBufferSize = 32
+
+// WebSocketAuditor is an Auditor implementation that streams key-access
+// events to every connected WebSocket client, for live fleet observability.
+// It exposes a single endpoint, "/events", that upgrades to a WebSocket
+// connection and pushes a keyAccessEvent as JSON for every Handle call. It
+// does not include a "sops audit serve" subcommand to run the listener
+// standalone, a replay log for clients that reconnect after missing events,
+// or a filter DSL to subscribe to a subset of events -- those would need
+// their own follow-up.
+type WebSocketAuditor struct {
+	upgrader websocket.Upgrader
+
+	mu sync.Mutex
+	// clients maps each connected client to its send buffer. Handle enqueues
+	// onto these channels rather than writing to the connection directly, so
+	// one slow or unresponsive client can't hold up delivery -- or the
+	// calling sops operation's audit write -- to the rest of the fleet.
+	clients map[*websocket.Conn]chan []byte
+}
+
+// NewWebSocketAuditor starts an HTTP server listening on listenAddr that
+// exposes a "/events" WebSocket endpoint, and returns an Auditor that
+// broadcasts every audited event to its connected clients.
+func NewWebSocketAuditor(listenAddr string) (*WebSocketAuditor, error) {
+	wsa := &WebSocketAuditor{
+		upgrader: websocket.Upgrader{
+			// Fleet observability clients are not served from a browser
+			// page on the same origin, so same-origin checks don't apply.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		clients: map[*websocket.Conn]chan []byte{},
+	}
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", wsa.handleEvents)
+
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Errorf("websocket audit server on %s stopped: %v", listenAddr, err)
+		}
+	}()
+
+	return wsa, nil
+}
+
+// handleEvents upgrades the request to a WebSocket connection and registers
+// it to receive broadcast events until it is closed by the client.
+func (wsa *WebSocketAuditor) handleEvents(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsa.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Errorf("failed to upgrade websocket connection: %v", err)
+		return
+	}
+
+	ch := make(chan []byte, clientSendBufferSize)
+	wsa.mu.Lock()
+	wsa.clients[conn] = ch
+	wsa.mu.Unlock()
+
+	go wsa.writeLoop(conn, ch)
+
+	// This connection is write-only from our side; read and discard
+	// incoming frames so pings/pongs and the eventual close frame are
+	// handled, and the client's disconnect is noticed.
+	go func() {
+		defer wsa.removeClient(conn)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// writeLoop delivers events queued in ch to conn until ch is closed by
+// removeClient or a write to conn fails, at which point it unregisters and
+// closes conn itself.
+func (wsa *WebSocketAuditor) writeLoop(conn *websocket.Conn, ch chan []byte) {
+	for msg := range ch {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			log.Warnf("dropping unresponsive websocket audit client: %v", err)
+			wsa.removeClient(conn)
+			return
+		}
+	}
+}
+
+// removeClient unregisters conn, closing its send buffer and the connection
+// itself. It is safe to call more than once for the same conn, from both the
+// read and write goroutines racing to notice the disconnect first.
+func (wsa *WebSocketAuditor) removeClient(conn *websocket.Conn) {
+	wsa.mu.Lock()
+	ch, ok := wsa.clients[conn]
+	if ok {
+		delete(wsa.clients, conn)
+	}
+	wsa.mu.Unlock()
+	if ok {
+		close(ch)
+	}
+	conn.Close()
+}
+
+// Handle broadcasts event to every connected WebSocket client as JSON,
+// queuing it onto each client's own send buffer rather than writing to
+// connections directly. A client that isn't draining its buffer fast enough
+// has the event dropped for it instead of blocking delivery to the rest of
+// the fleet -- or blocking the sops operation that's submitting this event.
+func (wsa *WebSocketAuditor) Handle(event interface{}) {
+	e, ok := keyAccessEventFor(event)
+	if !ok {
+		return
+	}
+	msg, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("failed to marshal key access event: %v", err)
+		return
+	}
+
+	wsa.mu.Lock()
+	defer wsa.mu.Unlock()
+	for conn, ch := range wsa.clients {
+		select {
+		case ch <- msg:
+		default:
+			log.Warnf("dropping event for slow websocket audit client")
+			delete(wsa.clients, conn)
+			close(ch)
+			conn.Close()
+		}
+	}
+}
+
+// keyAccessEventFor converts a known audit event into its keyAccessEvent
+// wire representation.
+func keyAccessEventFor(event interface{}) (keyAccessEvent, bool) {
+	now := time.Now().UTC()
+	switch e := event.(type) {
+	case DecryptEvent:
+		return keyAccessEvent{Action: "decrypt", File: e.File, Time: now}, true
+	case EncryptEvent:
+		return keyAccessEvent{Action: "encrypt", File: e.File, Time: now}, true
+	case RotateEvent:
+		return keyAccessEvent{Action: "rotate", File: e.File, Time: now}, true
+	default:
+		return keyAccessEvent{}, false
+	}
+}
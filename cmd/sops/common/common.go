@@ -1,6 +1,8 @@
 package common
 
 import (
+	"crypto/hmac"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -79,11 +81,19 @@ type DecryptTreeOpts struct {
 	IgnoreMac bool
 	// Cipher is the cryptographic cipher to use to decrypt the values inside the tree
 	Cipher sops.Cipher
+	// KeyServiceQuorum is the number of KeyServices that must agree on a
+	// MasterKey's decrypted data before it is accepted. Values less than 1
+	// behave like 1, accepting the first KeyService to succeed.
+	KeyServiceQuorum int
+	// Concurrency bounds how many MasterKeys within a single KeyGroup are
+	// queried for the data key at once. Values less than 1 mean unbounded,
+	// querying every MasterKey in the group at the same time.
+	Concurrency int
 }
 
 // DecryptTree decrypts the tree passed in through the DecryptTreeOpts and additionally returns the decrypted data key
 func DecryptTree(opts DecryptTreeOpts) (dataKey []byte, err error) {
-	dataKey, err = opts.Tree.Metadata.GetDataKeyWithKeyServices(opts.KeyServices, opts.DecryptionOrder)
+	dataKey, err = opts.Tree.Metadata.GetDataKeyWithKeyServicesQuorumAndConcurrency(opts.KeyServices, opts.DecryptionOrder, opts.KeyServiceQuorum, opts.Concurrency)
 	if err != nil {
 		return nil, NewExitError(err, codes.CouldNotRetrieveKey)
 	}
@@ -91,12 +101,13 @@ func DecryptTree(opts DecryptTreeOpts) (dataKey []byte, err error) {
 	if err != nil {
 		return nil, NewExitError(fmt.Sprintf("Error decrypting tree: %s", err), codes.ErrorDecryptingTree)
 	}
-	fileMac, err := opts.Cipher.Decrypt(opts.Tree.Metadata.MessageAuthenticationCode, dataKey, opts.Tree.Metadata.LastModified.Format(time.RFC3339))
+	decryptedFileMac, err := opts.Cipher.Decrypt(opts.Tree.Metadata.MessageAuthenticationCode, dataKey, opts.Tree.Metadata.LastModified.Format(time.RFC3339))
 	if !opts.IgnoreMac {
 		if err != nil {
 			return nil, NewExitError(fmt.Sprintf("Cannot decrypt MAC: %s", err), codes.MacMismatch)
 		}
-		if fileMac != computedMac {
+		fileMac, _ := decryptedFileMac.(string)
+		if !macsEqual(fileMac, computedMac) {
 			// If the file has an empty MAC, display "no MAC" instead of not displaying anything
 			if fileMac == "" {
 				fileMac = "no MAC"
@@ -107,6 +118,23 @@ func DecryptTree(opts DecryptTreeOpts) (dataKey []byte, err error) {
 	return dataKey, nil
 }
 
+// macsEqual reports whether two hex-encoded MACs represent the same bytes,
+// comparing them in constant time so that a file's MAC can't be brute-forced
+// byte-by-byte against a decryption oracle. Malformed hex is treated as a
+// mismatch rather than an error, since a tampered or corrupted MAC is exactly
+// the case this check exists to catch.
+func macsEqual(fileMac, computedMac string) bool {
+	fileMacBytes, err := hex.DecodeString(fileMac)
+	if err != nil {
+		return false
+	}
+	computedMacBytes, err := hex.DecodeString(computedMac)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(fileMacBytes, computedMacBytes)
+}
+
 // EncryptTreeOpts are the options needed to encrypt a tree
 type EncryptTreeOpts struct {
 	// Tree is the tree to be encrypted
@@ -119,6 +147,9 @@ type EncryptTreeOpts struct {
 
 // EncryptTree encrypts the tree passed in through the EncryptTreeOpts
 func EncryptTree(opts EncryptTreeOpts) error {
+	if opts.Tree.Metadata.MACAlgorithm == "" {
+		opts.Tree.Metadata.MACAlgorithm = sops.DefaultMACAlgorithm
+	}
 	unencryptedMac, err := opts.Tree.Encrypt(opts.DataKey, opts.Cipher)
 	if err != nil {
 		return NewExitError(fmt.Sprintf("Error encrypting tree: %s", err), codes.ErrorEncryptingTree)
@@ -246,6 +277,10 @@ type GenericDecryptOpts struct {
 	IgnoreMAC       bool
 	KeyServices     []keyservice.KeyServiceClient
 	DecryptionOrder []string
+	// KeyServiceQuorum is the number of KeyServices that must agree on a
+	// MasterKey's decrypted data before it is accepted. Values less than 1
+	// behave like 1, accepting the first KeyService to succeed.
+	KeyServiceQuorum int
 }
 
 // LoadEncryptedFileWithBugFixes is a wrapper around LoadEncryptedFile which includes
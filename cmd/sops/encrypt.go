@@ -20,8 +20,13 @@ type encryptConfig struct {
 	UnencryptedRegex  string
 	EncryptedRegex    string
 	MACOnlyEncrypted  bool
-	KeyGroups         []sops.KeyGroup
-	GroupThreshold    int
+	// MACAlgorithm is the name of the algorithm used to compute the file's
+	// MAC, as registered with sops.RegisterMACAlgorithm. An empty value
+	// leaves Metadata.MACAlgorithm unset, so EncryptTree falls back to
+	// sops.DefaultMACAlgorithm.
+	MACAlgorithm   string
+	KeyGroups      []sops.KeyGroup
+	GroupThreshold int
 }
 
 type encryptOpts struct {
@@ -67,6 +72,7 @@ func metadataFromEncryptionConfig(config encryptConfig) sops.Metadata {
 		UnencryptedRegex:  config.UnencryptedRegex,
 		EncryptedRegex:    config.EncryptedRegex,
 		MACOnlyEncrypted:  config.MACOnlyEncrypted,
+		MACAlgorithm:      config.MACAlgorithm,
 		Version:           version.Version,
 		ShamirThreshold:   config.GroupThreshold,
 	}
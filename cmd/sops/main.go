@@ -21,7 +21,7 @@ import (
 	"github.com/getsops/sops/v3"
 	"github.com/getsops/sops/v3/aes"
 	"github.com/getsops/sops/v3/age"
-	_ "github.com/getsops/sops/v3/audit"
+	"github.com/getsops/sops/v3/audit"
 	"github.com/getsops/sops/v3/azkv"
 	"github.com/getsops/sops/v3/cmd/sops/codes"
 	"github.com/getsops/sops/v3/cmd/sops/common"
@@ -1129,6 +1129,17 @@ func main() {
 					Usage:  "comma separated list of decryption key types",
 					EnvVar: "SOPS_DECRYPTION_ORDER",
 				},
+				cli.IntFlag{
+					Name:   "key-service-quorum",
+					Usage:  "the number of key services that must agree on a master key's decrypted data before it is accepted",
+					EnvVar: "SOPS_KEY_SERVICE_QUORUM",
+					Value:  1,
+				},
+				cli.IntFlag{
+					Name:   "concurrency",
+					Usage:  "the maximum number of master keys within a key group that are queried for the data key at once. 0 means unbounded",
+					EnvVar: "SOPS_CONCURRENCY",
+				},
 			}, keyserviceFlags...),
 			Action: func(c *cli.Context) error {
 				if c.Bool("verbose") {
@@ -1703,6 +1714,20 @@ func main() {
 			Name:  "mac-only-encrypted",
 			Usage: "compute MAC only over values which end up encrypted",
 		},
+		cli.StringFlag{
+			Name:   "mac-algorithm",
+			Usage:  "the algorithm used to compute a newly encrypted file's MAC, as registered with sops.RegisterMACAlgorithm. Defaults to sops.DefaultMACAlgorithm.",
+			EnvVar: "SOPS_MAC_ALGORITHM",
+		},
+		cli.StringFlag{
+			Name:  "acs-kms-max-age",
+			Usage: "a Go duration string (e.g. \"4320h\") after which an Alibaba Cloud KMS master key is considered due for rotation. Equivalent to setting SOPS_ACSKMS_ROTATION_MAX_AGE.",
+		},
+		cli.StringFlag{
+			Name:   "audit-config",
+			Usage:  "path to the audit backend config file. Equivalent to setting SOPS_AUDIT_CONFIG, except it takes effect after flags are parsed rather than at process startup.",
+			EnvVar: "SOPS_AUDIT_CONFIG",
+		},
 		cli.StringFlag{
 			Name:  "unencrypted-suffix",
 			Usage: "override the unencrypted key suffix.",
@@ -1777,6 +1802,14 @@ func main() {
 		if c.Bool("verbose") {
 			logging.SetLevel(logrus.DebugLevel)
 		}
+		if maxAge := c.String("acs-kms-max-age"); maxAge != "" {
+			os.Setenv("SOPS_ACSKMS_ROTATION_MAX_AGE", maxAge)
+		}
+		if auditConfig := c.String("audit-config"); auditConfig != "" {
+			if err := audit.Configure(auditConfig); err != nil {
+				return common.NewExitError(fmt.Sprintf("Error loading --audit-config: %s", err), codes.ErrorGeneric)
+			}
+		}
 		if c.NArg() < 1 {
 			return common.NewExitError("Error: no file specified", codes.NoFileSpecified)
 		}
@@ -2000,6 +2033,7 @@ func getEncryptConfig(c *cli.Context, fileName string) (encryptConfig, error) {
 	encryptedCommentRegex := c.String("encrypted-comment-regex")
 	unencryptedCommentRegex := c.String("unencrypted-comment-regex")
 	macOnlyEncrypted := c.Bool("mac-only-encrypted")
+	macAlgorithm := c.String("mac-algorithm")
 	conf, err := loadConfig(c, fileName, nil)
 	if err != nil {
 		return encryptConfig{}, toExitError(err)
@@ -2078,6 +2112,7 @@ func getEncryptConfig(c *cli.Context, fileName string) (encryptConfig, error) {
 		UnencryptedCommentRegex: unencryptedCommentRegex,
 		EncryptedCommentRegex:   encryptedCommentRegex,
 		MACOnlyEncrypted:        macOnlyEncrypted,
+		MACAlgorithm:            macAlgorithm,
 		KeyGroups:               groups,
 		GroupThreshold:          threshold,
 	}, nil
@@ -2135,6 +2170,8 @@ func getRotateOpts(c *cli.Context, fileName string, inputStore common.Store, out
 		Cipher:           aes.NewCipher(),
 		KeyServices:      svcs,
 		DecryptionOrder:  decryptionOrder,
+		KeyServiceQuorum: c.Int("key-service-quorum"),
+		Concurrency:      c.Int("concurrency"),
 		IgnoreMAC:        c.Bool("ignore-mac"),
 		AddMasterKeys:    addMasterKeys,
 		RemoveMasterKeys: rmMasterKeys,
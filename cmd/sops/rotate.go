@@ -21,16 +21,19 @@ type rotateOpts struct {
 	RemoveMasterKeys []keys.MasterKey
 	KeyServices      []keyservice.KeyServiceClient
 	DecryptionOrder  []string
+	KeyServiceQuorum int
+	Concurrency      int
 }
 
 func rotate(opts rotateOpts) ([]byte, error) {
 	tree, err := common.LoadEncryptedFileWithBugFixes(common.GenericDecryptOpts{
-		Cipher:          opts.Cipher,
-		InputStore:      opts.InputStore,
-		InputPath:       opts.InputPath,
-		IgnoreMAC:       opts.IgnoreMAC,
-		KeyServices:     opts.KeyServices,
-		DecryptionOrder: opts.DecryptionOrder,
+		Cipher:           opts.Cipher,
+		InputStore:       opts.InputStore,
+		InputPath:        opts.InputPath,
+		IgnoreMAC:        opts.IgnoreMAC,
+		KeyServices:      opts.KeyServices,
+		DecryptionOrder:  opts.DecryptionOrder,
+		KeyServiceQuorum: opts.KeyServiceQuorum,
 	})
 	if err != nil {
 		return nil, err
@@ -41,11 +44,13 @@ func rotate(opts rotateOpts) ([]byte, error) {
 	})
 
 	_, err = common.DecryptTree(common.DecryptTreeOpts{
-		Cipher:          opts.Cipher,
-		IgnoreMac:       opts.IgnoreMAC,
-		Tree:            tree,
-		KeyServices:     opts.KeyServices,
-		DecryptionOrder: opts.DecryptionOrder,
+		Cipher:           opts.Cipher,
+		IgnoreMac:        opts.IgnoreMAC,
+		Tree:             tree,
+		KeyServices:      opts.KeyServices,
+		DecryptionOrder:  opts.DecryptionOrder,
+		KeyServiceQuorum: opts.KeyServiceQuorum,
+		Concurrency:      opts.Concurrency,
 	})
 	if err != nil {
 		return nil, err
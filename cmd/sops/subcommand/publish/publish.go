@@ -7,14 +7,15 @@ import (
 	"path/filepath"
 	"strings"
 
-	"go.mozilla.org/sops/v3"
-	"go.mozilla.org/sops/v3/cmd/sops/codes"
-	"go.mozilla.org/sops/v3/cmd/sops/common"
-	"go.mozilla.org/sops/v3/config"
-	"go.mozilla.org/sops/v3/keyservice"
-	"go.mozilla.org/sops/v3/logging"
-	"go.mozilla.org/sops/v3/publish"
-	"go.mozilla.org/sops/v3/version"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/audit"
+	"github.com/getsops/sops/v3/cmd/sops/codes"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/keyservice"
+	"github.com/getsops/sops/v3/logging"
+	"github.com/getsops/sops/v3/publish"
+	"github.com/getsops/sops/v3/version"
 
 	"github.com/sirupsen/logrus"
 )
@@ -73,6 +74,10 @@ func Run(opts Opts) error {
 		return err
 	}
 
+	audit.SubmitEvent(audit.PublishEvent{
+		File: tree.FilePath,
+	})
+
 	data := map[string]interface{}{}
 
 	switch conf.Destination.(type) {
@@ -135,7 +140,7 @@ func Run(opts Opts) error {
 				return fmt.Errorf("could not read file: %s", err)
 			}
 		}
-	case *publish.VaultDestination:
+	case *publish.VaultDestination, *publish.FirebaseRemoteConfigDestination:
 		_, err = common.DecryptTree(common.DecryptTreeOpts{
 			Cipher:      opts.Cipher,
 			IgnoreMac:   false,
@@ -174,7 +179,7 @@ func Run(opts Opts) error {
 	switch dest := conf.Destination.(type) {
 	case *publish.S3Destination, *publish.GCSDestination:
 		err = dest.Upload(fileContents, destinationPath)
-	case *publish.VaultDestination:
+	case *publish.VaultDestination, *publish.FirebaseRemoteConfigDestination:
 		err = dest.UploadUnencrypted(data, destinationPath)
 	}
 
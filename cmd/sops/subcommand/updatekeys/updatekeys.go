@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/getsops/sops/v3/audit"
 	"github.com/getsops/sops/v3/cmd/sops/codes"
 	"github.com/getsops/sops/v3/cmd/sops/common"
 	"github.com/getsops/sops/v3/config"
@@ -102,6 +103,11 @@ func updateFile(opts Opts) error {
 	if err != nil {
 		return common.NewExitError(err, codes.CouldNotRetrieveKey)
 	}
+
+	audit.SubmitEvent(audit.UpdateKeysEvent{
+		File: tree.FilePath,
+	})
+
 	tree.Metadata.KeyGroups = conf.KeyGroups
 	tree.Metadata.ShamirThreshold = shamirThreshold
 	errs := tree.Metadata.UpdateMasterKeysWithKeyServices(key, opts.KeyServices)
@@ -165,6 +165,8 @@ type destinationRule struct {
 	VaultAddress     string       `yaml:"vault_address"`
 	VaultKVMountName string       `yaml:"vault_kv_mount_name"`
 	VaultKVVersion   int          `yaml:"vault_kv_version"`
+	FirebaseProject  string       `yaml:"firebase_project"`
+	FirebasePrefix   string       `yaml:"firebase_prefix"`
 	RecreationRule   creationRule `yaml:"recreation_rule,omitempty"`
 	OmitExtensions   bool         `yaml:"omit_extensions"`
 }
@@ -412,7 +414,13 @@ func parseDestinationRuleForFile(conf *configFile, filePath string, kmsEncryptio
 	}
 
 	var dest publish.Destination
-	if dRule.S3Bucket != "" && dRule.GCSBucket != "" && dRule.VaultPath != "" {
+	destCount := 0
+	for _, set := range []bool{dRule.S3Bucket != "", dRule.GCSBucket != "", dRule.VaultPath != "", dRule.FirebaseProject != ""} {
+		if set {
+			destCount++
+		}
+	}
+	if destCount > 1 {
 		return nil, fmt.Errorf("error loading config: more than one destinations were found in a single destination rule, you can only use one per rule")
 	}
 	if dRule.S3Bucket != "" {
@@ -424,6 +432,9 @@ func parseDestinationRuleForFile(conf *configFile, filePath string, kmsEncryptio
 	if dRule.VaultPath != "" {
 		dest = publish.NewVaultDestination(dRule.VaultAddress, dRule.VaultPath, dRule.VaultKVMountName, dRule.VaultKVVersion)
 	}
+	if dRule.FirebaseProject != "" {
+		dest = publish.NewFirebaseRemoteConfigDestination(dRule.FirebaseProject, dRule.FirebasePrefix)
+	}
 
 	config, err := configFromRule(rule, kmsEncryptionContext)
 	if err != nil {
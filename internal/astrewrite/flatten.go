@@ -0,0 +1,224 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// FlattenOptions configures Flatten.
+type FlattenOptions struct {
+	// MarkerCall, if non-empty, restricts flattening to functions whose body
+	// contains a call to this qualified name (as resolved by calleeName),
+	// e.g. "runtime.Gosched". An empty MarkerCall flattens every function.
+	MarkerCall string
+}
+
+// Flatten lowers each eligible function body in file into a single
+// top-level `for { switch $state { ... } }` dispatch loop, where each case
+// represents one basic block and control flow (if/for/break/continue/
+// return) is rewritten as an assignment to $state followed by `continue`.
+// This produces resumable, coroutine-style bodies: execution can be
+// suspended and resumed at any case boundary.
+//
+// The block-numbering scheme here handles straight-line code, if/else, and
+// for/break/continue; it does not attempt to lower goto, select, or
+// multi-result defer stacks, which are left untouched (deferred calls still
+// run via the original `defer` statement, just inside the dispatch loop's
+// function scope).
+func Flatten(file *ast.File, info *types.Info, opts FlattenOptions) *ast.File {
+	c := &flattenContext{info: info, opts: opts}
+	decls := make([]ast.Decl, len(file.Decls))
+	for i, decl := range file.Decls {
+		decls[i] = c.flattenDecl(decl)
+	}
+	newFile := &ast.File{
+		Doc:        file.Doc,
+		Package:    file.Package,
+		Name:       file.Name,
+		Decls:      decls,
+		Scope:      file.Scope,
+		Imports:    file.Imports,
+		Unresolved: file.Unresolved,
+		Comments:   file.Comments,
+	}
+	c.info.Scopes[newFile] = c.info.Scopes[file]
+	return newFile
+}
+
+type flattenContext struct {
+	info  *types.Info
+	opts  FlattenOptions
+	state *ast.Ident
+	// breakState/continueState give the target state for a bare break or
+	// continue in the innermost enclosing loop.
+	breakState, continueState int
+	nextState                 int
+	blocks                    []*ast.CaseClause
+}
+
+func (c *flattenContext) flattenDecl(decl ast.Decl) ast.Decl {
+	fd, ok := decl.(*ast.FuncDecl)
+	if !ok || fd.Body == nil {
+		return decl
+	}
+	if c.opts.MarkerCall != "" && !containsMarkerCall(fd.Body, c.info, c.opts.MarkerCall) {
+		return decl
+	}
+
+	fc := &flattenContext{info: c.info, opts: c.opts, state: ast.NewIdent("_state")}
+	fc.info.Types[fc.state] = types.TypeAndValue{Type: types.Typ[types.Int]}
+
+	entry := fc.newBlock()
+	exit := fc.newBlock()
+	fc.emit(entry, fd.Body.List, exit)
+	fc.blocks[exit].Body = []ast.Stmt{&ast.BranchStmt{Tok: token.BREAK}}
+
+	clauses := make([]ast.Stmt, len(fc.blocks))
+	for i, b := range fc.blocks {
+		clauses[i] = b
+	}
+
+	newFd := *fd
+	newFd.Body = &ast.BlockStmt{List: []ast.Stmt{
+		&ast.DeclStmt{Decl: &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names:  []*ast.Ident{fc.state},
+				Type:   ast.NewIdent("int"),
+				Values: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: "0"}},
+			}},
+		}},
+		&ast.ForStmt{
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.SwitchStmt{
+					Tag:  fc.state,
+					Body: &ast.BlockStmt{List: clauses},
+				},
+			}},
+		},
+	}}
+	return &newFd
+}
+
+// newBlock allocates a fresh state number and its (initially empty) case
+// clause, returning the state number.
+func (c *flattenContext) newBlock() int {
+	n := c.nextState
+	c.nextState++
+	c.blocks = append(c.blocks, &ast.CaseClause{
+		List: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: itoa(n)}},
+	})
+	return n
+}
+
+func (c *flattenContext) setState(n int) ast.Stmt {
+	return &ast.AssignStmt{Lhs: []ast.Expr{c.state}, Tok: token.ASSIGN, Rhs: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: itoa(n)}}}
+}
+
+func (c *flattenContext) gotoBlock(n int) []ast.Stmt {
+	return []ast.Stmt{c.setState(n), &ast.BranchStmt{Tok: token.CONTINUE}}
+}
+
+// emit lowers stmts into block's case clause, falling through to next on
+// normal completion.
+func (c *flattenContext) emit(block int, stmts []ast.Stmt, next int) {
+	body := &c.blocks[block].Body
+	for i, s := range stmts {
+		switch s := s.(type) {
+		case *ast.IfStmt:
+			thenState := c.newBlock()
+			elseState := next
+			if s.Else != nil {
+				elseState = c.newBlock()
+			}
+			after := c.newBlock()
+
+			*body = append(*body, &ast.IfStmt{
+				Cond: s.Cond,
+				Body: &ast.BlockStmt{List: c.gotoBlock(thenState)},
+				Else: &ast.BlockStmt{List: c.gotoBlock(elseState)},
+			})
+			c.emit(thenState, s.Body.List, after)
+			if s.Else != nil {
+				c.emit(elseState, unwrapBlock(s.Else), after)
+			}
+			c.finishInto(after, stmts[i+1:], next)
+			return
+
+		case *ast.ForStmt:
+			head := c.newBlock()
+			bodyState := c.newBlock()
+			postState := c.newBlock()
+			after := c.newBlock()
+			prevBreak, prevContinue := c.breakState, c.continueState
+			c.breakState, c.continueState = after, postState
+
+			*body = append(*body, c.gotoBlock(head)...)
+			headBody := &c.blocks[head].Body
+			if s.Cond != nil {
+				*headBody = append(*headBody, &ast.IfStmt{
+					Cond: &ast.UnaryExpr{Op: token.NOT, X: s.Cond},
+					Body: &ast.BlockStmt{List: c.gotoBlock(after)},
+				})
+			}
+			*headBody = append(*headBody, c.gotoBlock(bodyState)...)
+
+			// bodyState falls through to postState, which runs the loop's
+			// Post statement (if any) and jumps back to head; continue
+			// targets postState directly, so Post still runs on continue.
+			c.emit(bodyState, s.Body.List, postState)
+			postBody := &c.blocks[postState].Body
+			if s.Post != nil {
+				*postBody = append(*postBody, s.Post)
+			}
+			*postBody = append(*postBody, c.gotoBlock(head)...)
+
+			c.breakState, c.continueState = prevBreak, prevContinue
+			c.finishInto(after, stmts[i+1:], next)
+			return
+
+		case *ast.BranchStmt:
+			switch s.Tok {
+			case token.BREAK:
+				*body = append(*body, c.gotoBlock(c.breakState)...)
+				return
+			case token.CONTINUE:
+				*body = append(*body, c.gotoBlock(c.continueState)...)
+				return
+			default:
+				*body = append(*body, s)
+			}
+
+		case *ast.ReturnStmt:
+			*body = append(*body, s, &ast.BranchStmt{Tok: token.BREAK})
+			return
+
+		default:
+			*body = append(*body, s)
+		}
+	}
+	*body = append(*body, c.gotoBlock(next)...)
+}
+
+// finishInto continues lowering the remaining statements of the enclosing
+// block into the `after`/merge state.
+func (c *flattenContext) finishInto(after int, rest []ast.Stmt, next int) {
+	c.emit(after, rest, next)
+}
+
+func containsMarkerCall(n ast.Node, info *types.Info, marker string) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		call, ok := n.(*ast.CallExpr)
+		if ok && calleeName(call.Fun, info) == marker {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found
+}
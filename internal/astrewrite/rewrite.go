@@ -0,0 +1,364 @@
+package astrewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+// Predicate constrains a rule match based on the types of the expressions
+// bound to its metavariables. It receives the type-checker info for the file
+// being rewritten together with the current bindings.
+type Predicate func(info *types.Info, binds map[string]ast.Expr) bool
+
+// Rule pairs a pattern AST, which may contain "$name" metavariables, with a
+// template AST referring to the same metavariables. Applying a Rule replaces
+// every match of Pattern with Template, after substituting the bound
+// subtrees, provided Check (if non-nil) reports true for the match.
+type Rule struct {
+	Pattern  ast.Expr
+	Template ast.Expr
+	Check    Predicate
+}
+
+// Rewriter applies a fixed set of Rules to a *ast.File.
+type Rewriter struct {
+	rules []Rule
+}
+
+// NewRewriter builds a Rewriter from the given rules. Rules are tried in
+// order; the first one that matches a node wins.
+func NewRewriter(rules []Rule) *Rewriter {
+	return &Rewriter{rules: rules}
+}
+
+// Rewrite applies r's rules to file, rewriting every matching expression and
+// re-registering types/uses for any new nodes in info so the result stays
+// type-checkable.
+func (r *Rewriter) Rewrite(file *ast.File, info *types.Info) *ast.File {
+	c := &rewriteContext{Rewriter: r, info: info}
+	decls := make([]ast.Decl, len(file.Decls))
+	for i, decl := range file.Decls {
+		decls[i] = c.rewriteDecl(decl)
+	}
+	newFile := &ast.File{
+		Doc:        file.Doc,
+		Package:    file.Package,
+		Name:       file.Name,
+		Decls:      decls,
+		Scope:      file.Scope,
+		Imports:    file.Imports,
+		Unresolved: file.Unresolved,
+		Comments:   file.Comments,
+	}
+	c.info.Scopes[newFile] = c.info.Scopes[file]
+	return newFile
+}
+
+type rewriteContext struct {
+	*Rewriter
+	info *types.Info
+}
+
+func (c *rewriteContext) rewriteDecl(decl ast.Decl) ast.Decl {
+	fd, ok := decl.(*ast.FuncDecl)
+	if !ok {
+		return decl
+	}
+	newFd := *fd
+	newFd.Body = c.rewriteBlock(fd.Body)
+	return &newFd
+}
+
+func (c *rewriteContext) rewriteBlock(b *ast.BlockStmt) *ast.BlockStmt {
+	if b == nil {
+		return nil
+	}
+	newB := &ast.BlockStmt{Lbrace: b.Lbrace, Rbrace: b.Rbrace}
+	newB.List = make([]ast.Stmt, len(b.List))
+	for i, s := range b.List {
+		newB.List[i] = c.rewriteStmt(s)
+	}
+	c.info.Scopes[newB] = c.info.Scopes[b]
+	return newB
+}
+
+// rewriteStmt rewrites every expression reachable from s, applying rules
+// bottom-up so that a match produced by rewriting a subexpression can itself
+// be matched by an outer rule.
+func (c *rewriteContext) rewriteStmt(s ast.Stmt) ast.Stmt {
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		return &ast.ExprStmt{X: c.rewriteExpr(s.X)}
+	case *ast.BlockStmt:
+		return c.rewriteBlock(s)
+	case *ast.AssignStmt:
+		newS := *s
+		newS.Lhs = c.rewriteExprList(s.Lhs)
+		newS.Rhs = c.rewriteExprList(s.Rhs)
+		return &newS
+	case *ast.ReturnStmt:
+		return &ast.ReturnStmt{Return: s.Return, Results: c.rewriteExprList(s.Results)}
+	case *ast.IfStmt:
+		newS := *s
+		newS.Cond = c.rewriteExpr(s.Cond)
+		newS.Body = c.rewriteBlock(s.Body)
+		if s.Else != nil {
+			newS.Else = c.rewriteStmt(s.Else)
+		}
+		return &newS
+	case *ast.ForStmt:
+		newS := *s
+		newS.Cond = c.rewriteExpr(s.Cond)
+		newS.Body = c.rewriteBlock(s.Body)
+		return &newS
+	default:
+		return s
+	}
+}
+
+func (c *rewriteContext) rewriteExprList(exprs []ast.Expr) []ast.Expr {
+	if exprs == nil {
+		return nil
+	}
+	out := make([]ast.Expr, len(exprs))
+	for i, x := range exprs {
+		out[i] = c.rewriteExpr(x)
+	}
+	return out
+}
+
+// rewriteExpr rewrites x's children first, then tries x itself against each
+// rule in order.
+func (c *rewriteContext) rewriteExpr(x ast.Expr) ast.Expr {
+	if x == nil {
+		return nil
+	}
+	switch x := x.(type) {
+	case *ast.CallExpr:
+		newX := *x
+		newX.Fun = c.rewriteExpr(x.Fun)
+		newX.Args = c.rewriteExprList(x.Args)
+		x = &newX
+	case *ast.BinaryExpr:
+		newX := *x
+		newX.X = c.rewriteExpr(x.X)
+		newX.Y = c.rewriteExpr(x.Y)
+		x = &newX
+	case *ast.ParenExpr:
+		newX := *x
+		newX.X = c.rewriteExpr(x.X)
+		x = &newX
+	case *ast.SelectorExpr:
+		newX := *x
+		newX.X = c.rewriteExpr(x.X)
+		if sel, ok := c.info.Selections[x]; ok {
+			c.info.Selections[&newX] = sel
+		}
+		x = &newX
+	}
+
+	for _, rule := range c.rules {
+		binds := map[string]ast.Expr{}
+		if match(rule.Pattern, x, binds) && (rule.Check == nil || rule.Check(c.info, binds)) {
+			result := substitute(rule.Template, binds, c.info)
+			if t, ok := c.info.Types[x]; ok {
+				c.info.Types[result] = t
+			}
+			return result
+		}
+	}
+	return x
+}
+
+// isMetaVar reports whether n is a "$name" metavariable identifier.
+func isMetaVar(n ast.Node) (string, bool) {
+	id, ok := n.(*ast.Ident)
+	if !ok || !strings.HasPrefix(id.Name, "$") {
+		return "", false
+	}
+	return id.Name, true
+}
+
+// match reports whether node matches pattern, recording metavariable
+// bindings into binds. A repeated metavariable must bind an identical
+// subtree (by types.Identical when both sides carry a known type, or by
+// structural equality otherwise).
+func match(pattern, node ast.Node, binds map[string]ast.Expr) bool {
+	if name, ok := isMetaVar(pattern); ok {
+		nodeExpr, ok := node.(ast.Expr)
+		if !ok {
+			return false
+		}
+		if prev, bound := binds[name]; bound {
+			return exprEqual(prev, nodeExpr)
+		}
+		binds[name] = nodeExpr
+		return true
+	}
+
+	if pattern == nil || node == nil {
+		return pattern == node
+	}
+	if reflect.TypeOf(pattern) != reflect.TypeOf(node) {
+		return false
+	}
+
+	switch p := pattern.(type) {
+	case *ast.Ident:
+		return p.Name == node.(*ast.Ident).Name
+	case *ast.BasicLit:
+		n := node.(*ast.BasicLit)
+		return p.Kind == n.Kind && p.Value == n.Value
+	case *ast.CallExpr:
+		n := node.(*ast.CallExpr)
+		if len(p.Args) != len(n.Args) {
+			return false
+		}
+		if !match(p.Fun, n.Fun, binds) {
+			return false
+		}
+		for i := range p.Args {
+			if !match(p.Args[i], n.Args[i], binds) {
+				return false
+			}
+		}
+		return true
+	case *ast.BinaryExpr:
+		n := node.(*ast.BinaryExpr)
+		return p.Op == n.Op && match(p.X, n.X, binds) && match(p.Y, n.Y, binds)
+	case *ast.UnaryExpr:
+		n := node.(*ast.UnaryExpr)
+		return p.Op == n.Op && match(p.X, n.X, binds)
+	case *ast.ParenExpr:
+		n := node.(*ast.ParenExpr)
+		return match(p.X, n.X, binds)
+	case *ast.SelectorExpr:
+		n := node.(*ast.SelectorExpr)
+		return p.Sel.Name == n.Sel.Name && match(p.X, n.X, binds)
+	case *ast.ExprStmt:
+		n := node.(*ast.ExprStmt)
+		return match(p.X, n.X, binds)
+	default:
+		return exprEqual(pattern, node)
+	}
+}
+
+// exprEqual reports whether two already-bound subtrees are the same
+// expression, falling back to a source-independent structural comparison.
+func exprEqual(a, b ast.Node) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	switch a := a.(type) {
+	case *ast.Ident:
+		return a.Name == b.(*ast.Ident).Name
+	case *ast.BasicLit:
+		bb := b.(*ast.BasicLit)
+		return a.Kind == bb.Kind && a.Value == bb.Value
+	case *ast.SelectorExpr:
+		bb := b.(*ast.SelectorExpr)
+		return a.Sel.Name == bb.Sel.Name && exprEqual(a.X, bb.X)
+	case *ast.CallExpr:
+		bb := b.(*ast.CallExpr)
+		if len(a.Args) != len(bb.Args) || !exprEqual(a.Fun, bb.Fun) {
+			return false
+		}
+		for i := range a.Args {
+			if !exprEqual(a.Args[i], bb.Args[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// substitute produces a copy of template with every metavariable replaced by
+// its binding, registering the copied identifiers/uses in info so the result
+// remains type-checked.
+func substitute(template ast.Expr, binds map[string]ast.Expr, info *types.Info) ast.Expr {
+	if name, ok := isMetaVar(template); ok {
+		if bound, ok := binds[name]; ok {
+			return bound
+		}
+		return template
+	}
+
+	switch t := template.(type) {
+	case *ast.CallExpr:
+		args := make([]ast.Expr, len(t.Args))
+		for i, a := range t.Args {
+			args[i] = substitute(a, binds, info)
+		}
+		return &ast.CallExpr{Fun: substitute(t.Fun, binds, info), Args: args, Ellipsis: t.Ellipsis}
+	case *ast.BinaryExpr:
+		return &ast.BinaryExpr{X: substitute(t.X, binds, info), Op: t.Op, Y: substitute(t.Y, binds, info)}
+	case *ast.UnaryExpr:
+		return &ast.UnaryExpr{Op: t.Op, X: substitute(t.X, binds, info)}
+	case *ast.ParenExpr:
+		return &ast.ParenExpr{X: substitute(t.X, binds, info)}
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: substitute(t.X, binds, info), Sel: t.Sel}
+	default:
+		return template
+	}
+}
+
+// RuleSet parses a Go source file containing pattern/replacement pairs and
+// returns the Rules it declares. Each rule is a pair of consecutive
+// expression statements inside a function body, the first being the
+// pattern and the second its replacement, immediately preceded by a
+// "// rule: <name>" comment, e.g.:
+//
+//	func rules() {
+//		// rule: deprecated key lookup
+//		oldLookup($ks, $id)
+//		newLookup($ks, $id)
+//	}
+//
+// Metavariables are identifiers starting with "$" and may repeat on both
+// sides of a rule.
+func RuleSet(filename, src string) ([]Rule, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("astrewrite: parsing rule file: %w", err)
+	}
+
+	markers := map[int]bool{}
+	for _, cg := range f.Comments {
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, "// rule:") {
+				markers[fset.Position(c.End()).Line] = true
+			}
+		}
+	}
+
+	var rules []Rule
+	ast.Inspect(f, func(n ast.Node) bool {
+		fd, ok := n.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			return true
+		}
+		list := fd.Body.List
+		for i := 0; i < len(list)-1; i++ {
+			es, ok := list[i].(*ast.ExprStmt)
+			if !ok || !markers[fset.Position(es.Pos()).Line-1] {
+				continue
+			}
+			next, ok := list[i+1].(*ast.ExprStmt)
+			if !ok {
+				continue
+			}
+			rules = append(rules, Rule{Pattern: es.X, Template: next.X})
+		}
+		return true
+	})
+	return rules, nil
+}
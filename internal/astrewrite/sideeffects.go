@@ -0,0 +1,188 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// SideEffectClass classifies the side effects an expression may have when
+// evaluated.
+type SideEffectClass int
+
+const (
+	// Pure expressions have no observable side effect and always terminate
+	// normally: evaluating them twice is equivalent to evaluating them once.
+	Pure SideEffectClass = iota
+	// ReadsMemory expressions observe mutable state (a pointer, map, slice,
+	// or global) but do not modify it.
+	ReadsMemory
+	// WritesMemory expressions mutate state.
+	WritesMemory
+	// Panics expressions may panic at runtime (nil dereference, out-of-range
+	// index, etc.) even if they otherwise read no mutable state.
+	Panics
+	// Unknown covers anything the analyzer can't classify, such as calls to
+	// functions it has no information about. Callers should treat Unknown
+	// the same as WritesMemory for safety.
+	Unknown
+)
+
+// defaultPureFuncs are builtins and standard-library functions known to be
+// pure regardless of their arguments.
+var defaultPureFuncs = map[string]bool{
+	"len": true, "cap": true,
+	"unsafe.Sizeof": true, "unsafe.Alignof": true, "unsafe.Offsetof": true,
+	"math.Abs": true, "math.Max": true, "math.Min": true, "math.Sqrt": true,
+	"math.Floor": true, "math.Ceil": true, "math.Trunc": true, "math.Round": true,
+}
+
+// SideEffects classifies expr's side effects using info to resolve call
+// targets and, for *ast.CallExpr, consulting pureFuncs (in addition to
+// SideEffects' own small built-in allowlist) to decide whether a call is
+// known-pure. pureFuncs may be nil. Function names are matched against their
+// qualified form ("pkg.Name", or just "Name" for builtins/package-local
+// calls).
+func SideEffects(expr ast.Expr, info *types.Info, pureFuncs map[string]bool) SideEffectClass {
+	if expr == nil {
+		return Pure
+	}
+	switch x := expr.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		return Pure
+
+	case *ast.ParenExpr:
+		return SideEffects(x.X, info, pureFuncs)
+
+	case *ast.SelectorExpr:
+		return maxClass(SideEffects(x.X, info, pureFuncs), ReadsMemory)
+
+	case *ast.UnaryExpr:
+		base := SideEffects(x.X, info, pureFuncs)
+		if x.Op.String() == "*" {
+			return maxClass(base, ReadsMemory, Panics)
+		}
+		return base
+
+	case *ast.StarExpr:
+		return maxClass(SideEffects(x.X, info, pureFuncs), ReadsMemory, Panics)
+
+	case *ast.IndexExpr:
+		return maxClass(SideEffects(x.X, info, pureFuncs), SideEffects(x.Index, info, pureFuncs), ReadsMemory, Panics)
+
+	case *ast.SliceExpr:
+		c := maxClass(SideEffects(x.X, info, pureFuncs), ReadsMemory, Panics)
+		for _, e := range []ast.Expr{x.Low, x.High, x.Max} {
+			if e != nil {
+				c = maxClass(c, SideEffects(e, info, pureFuncs))
+			}
+		}
+		return c
+
+	case *ast.BinaryExpr:
+		c := maxClass(SideEffects(x.X, info, pureFuncs), SideEffects(x.Y, info, pureFuncs))
+		switch x.Op.String() {
+		case "/", "%":
+			c = maxClass(c, Panics)
+		}
+		return c
+
+	case *ast.TypeAssertExpr:
+		c := maxClass(SideEffects(x.X, info, pureFuncs), ReadsMemory)
+		if x.Type != nil {
+			c = maxClass(c, Panics)
+		}
+		return c
+
+	case *ast.CompositeLit:
+		c := Pure
+		for _, elt := range x.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				c = maxClass(c, SideEffects(kv.Value, info, pureFuncs))
+				continue
+			}
+			c = maxClass(c, SideEffects(elt, info, pureFuncs))
+		}
+		return c
+
+	case *ast.FuncLit:
+		return Pure
+
+	case *ast.CallExpr:
+		return callSideEffects(x, info, pureFuncs)
+
+	default:
+		return Unknown
+	}
+}
+
+func callSideEffects(call *ast.CallExpr, info *types.Info, pureFuncs map[string]bool) SideEffectClass {
+	if isBuiltinConversion(call, info) {
+		c := Pure
+		for _, a := range call.Args {
+			c = maxClass(c, SideEffects(a, info, pureFuncs))
+		}
+		return c
+	}
+
+	name := calleeName(call.Fun, info)
+	pure := defaultPureFuncs[name] || pureFuncs[name]
+
+	c := Pure
+	for _, a := range call.Args {
+		c = maxClass(c, SideEffects(a, info, pureFuncs))
+	}
+	if !pure {
+		c = maxClass(c, Unknown)
+	}
+	return c
+}
+
+// calleeName returns the qualified name ("pkg.Name") of a call target when
+// it can be resolved via info.Uses, or the empty string otherwise.
+func calleeName(fun ast.Expr, info *types.Info) string {
+	switch f := fun.(type) {
+	case *ast.Ident:
+		if info == nil {
+			return f.Name
+		}
+		if obj, ok := info.Uses[f]; ok {
+			if pkg := obj.Pkg(); pkg != nil {
+				return pkg.Path() + "." + f.Name
+			}
+		}
+		return f.Name
+	case *ast.SelectorExpr:
+		if pkgIdent, ok := f.X.(*ast.Ident); ok {
+			if info != nil {
+				if _, isPkg := info.Uses[pkgIdent].(*types.PkgName); isPkg {
+					return pkgIdent.Name + "." + f.Sel.Name
+				}
+			}
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+func isBuiltinConversion(call *ast.CallExpr, info *types.Info) bool {
+	if info == nil {
+		return false
+	}
+	id, ok := call.Fun.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = info.Uses[id].(*types.TypeName)
+	return ok
+}
+
+func maxClass(classes ...SideEffectClass) SideEffectClass {
+	max := Pure
+	for _, c := range classes {
+		if c > max {
+			max = c
+		}
+	}
+	return max
+}
@@ -12,10 +12,19 @@ type simplifyContext struct {
 	info          *types.Info
 	varCounter    int
 	simplifyCalls bool
+	pureFuncs     map[string]bool
 }
 
 func Simplify(file *ast.File, info *types.Info, simplifyCalls bool) *ast.File {
-	c := &simplifyContext{info: info, simplifyCalls: simplifyCalls}
+	return SimplifyWithPureFuncs(file, info, simplifyCalls, nil)
+}
+
+// SimplifyWithPureFuncs behaves like Simplify, but additionally treats every
+// function named in pureFuncs (see SideEffects) as known-pure, which avoids
+// introducing a temporary variable for calls and short-circuit operands that
+// don't need one.
+func SimplifyWithPureFuncs(file *ast.File, info *types.Info, simplifyCalls bool, pureFuncs map[string]bool) *ast.File {
+	c := &simplifyContext{info: info, simplifyCalls: simplifyCalls, pureFuncs: pureFuncs}
 
 	decls := make([]ast.Decl, len(file.Decls))
 	for i, decl := range file.Decls {
@@ -225,43 +234,91 @@ func (c *simplifyContext) simplifyStmt(stmts *[]ast.Stmt, s ast.Stmt) {
 		*stmts = append(*stmts, newS)
 
 	case *ast.ForStmt:
-		newS := &ast.ForStmt{
-			For:  s.For,
-			Init: s.Init,
-			Cond: s.Cond,
-			Post: s.Post,
-			Body: c.simplifyBlock(s.Body),
+		if !c.simplifyCalls {
+			newS := &ast.ForStmt{
+				For:  s.For,
+				Init: s.Init,
+				Cond: s.Cond,
+				Post: s.Post,
+				Body: c.simplifyBlock(s.Body),
+			}
+			c.info.Scopes[newS] = c.info.Scopes[s]
+			*stmts = append(*stmts, newS)
+			break
+		}
+
+		block := &ast.BlockStmt{}
+		*stmts = append(*stmts, block)
+		outer := stmts
+		stmts = &block.List
+
+		c.simplifyStmt(stmts, s.Init)
+
+		var condStmts []ast.Stmt
+		var cond ast.Expr
+		if s.Cond != nil {
+			cond = c.newVar(&condStmts, s.Cond)
+		}
+
+		var post ast.Stmt
+		var postPrefix []ast.Stmt
+		if s.Post != nil {
+			var postStmts []ast.Stmt
+			c.simplifyStmt(&postStmts, s.Post)
+			switch len(postStmts) {
+			case 1:
+				post = postStmts[0]
+			default:
+				// Post couldn't be simplified into a single statement (it
+				// contains calls); run the extra bookkeeping from a label at
+				// the end of the body instead, and rewrite `continue` to jump
+				// there (see rewriteBareContinues below).
+				post = postStmts[len(postStmts)-1]
+				postPrefix = postStmts[:len(postStmts)-1]
+			}
+		}
+
+		bodyStmts := c.simplifyStmtList(s.Body.List)
+		if len(condStmts) != 0 {
+			bodyStmts = append(append(condStmts, &ast.IfStmt{
+				Cond: &ast.UnaryExpr{
+					Op: token.NOT,
+					X:  cond,
+				},
+				Body: &ast.BlockStmt{
+					List: []ast.Stmt{&ast.BranchStmt{
+						Tok: token.BREAK,
+					}},
+				},
+			}), bodyStmts...)
+			cond = nil
+		}
+		if len(postPrefix) != 0 {
+			// Post didn't simplify into a single statement, so its extra
+			// statements run from a label at the end of the body instead of
+			// from ForStmt.Post. A bare `continue` in the body would normally
+			// reach Post directly, skipping that label entirely, so rewrite
+			// those continues to jump to it explicitly.
+			continueLabel := fmt.Sprintf("_continue%d", c.varCounter)
+			rewriteBareContinues(bodyStmts, continueLabel)
+			bodyStmts = append(bodyStmts, &ast.LabeledStmt{
+				Label: ast.NewIdent(continueLabel),
+				Stmt:  &ast.BlockStmt{List: postPrefix},
+			})
 		}
-		c.info.Scopes[newS] = c.info.Scopes[s]
-		*stmts = append(*stmts, newS)
 
-	// case *ast.ForStmt:
-	// 	c.simplifyStmt(stmts, s.Init)
-	// 	var condStmts []ast.Stmt
-	// 	cond := c.newVar(&condStmts, s.Cond)
-	// 	bodyStmts := s.Body.List
-	// 	if len(condStmts) != 0 {
-	// 		bodyStmts = append(append(condStmts, &ast.IfStmt{
-	// 			Cond: &ast.UnaryExpr{
-	// 				Op: token.NOT,
-	// 				X:  cond,
-	// 			},
-	// 			Body: &ast.BlockStmt{
-	// 				List: []ast.Stmt{&ast.BranchStmt{
-	// 					Tok: token.BREAK,
-	// 				}},
-	// 			},
-	// 		}), bodyStmts...)
-	// 		cond = nil
-	// 	}
-	// 	*stmts = append(*stmts, &ast.ForStmt{
-	// 		For:  s.For,
-	// 		Cond: cond,
-	// 		Post: s.Post,
-	// 		Body: &ast.BlockStmt{
-	// 			List: bodyStmts,
-	// 		},
-	// 	})
+		newFor := &ast.ForStmt{
+			For:  s.For,
+			Cond: cond,
+			Post: post,
+			Body: &ast.BlockStmt{
+				List: bodyStmts,
+			},
+		}
+		c.info.Scopes[newFor] = c.info.Scopes[s]
+		c.info.Scopes[block] = c.info.Scopes[s]
+		*stmts = append(*stmts, newFor)
+		stmts = outer
 
 	case *ast.RangeStmt:
 		var newS ast.Stmt
@@ -683,7 +740,7 @@ func (c *simplifyContext) simplifyExpr3(stmts *[]ast.Stmt, x ast.Expr, callOK bo
 
 	case *ast.CallExpr:
 		call := c.simplifyCall(stmts, x)
-		if callOK || !c.simplifyCalls {
+		if callOK || !c.simplifyCalls || SideEffects(x, c.info, c.pureFuncs) == Pure {
 			return call
 		}
 		return c.newVar(stmts, call)
@@ -702,7 +759,8 @@ func (c *simplifyContext) simplifyExpr3(stmts *[]ast.Stmt, x ast.Expr, callOK bo
 		}
 
 	case *ast.BinaryExpr:
-		if (x.Op == token.LAND || x.Op == token.LOR) && c.simplifyCalls && ContainsCall(x.Y) {
+		if (x.Op == token.LAND || x.Op == token.LOR) && c.simplifyCalls && ContainsCall(x.Y) &&
+			!(SideEffects(x.X, c.info, c.pureFuncs) == Pure && SideEffects(x.Y, c.info, c.pureFuncs) == Pure) {
 			v := c.newVar(stmts, x.X)
 			cond := v
 			if x.Op == token.LOR {
@@ -833,3 +891,54 @@ func ContainsCall(x ast.Expr) bool {
 		return false
 	}
 }
+
+// rewriteBareContinues rewrites unlabeled `continue` statements in stmts into
+// `goto label`, without descending into nested for/range loops, whose own
+// unlabeled continues target themselves rather than the enclosing loop that
+// label belongs to.
+func rewriteBareContinues(stmts []ast.Stmt, label string) {
+	for i, s := range stmts {
+		stmts[i] = rewriteBareContinuesInStmt(s, label)
+	}
+}
+
+func rewriteBareContinuesInStmt(s ast.Stmt, label string) ast.Stmt {
+	switch s := s.(type) {
+	case *ast.BranchStmt:
+		if s.Tok == token.CONTINUE && s.Label == nil {
+			return &ast.BranchStmt{Tok: token.GOTO, Label: ast.NewIdent(label)}
+		}
+		return s
+	case *ast.BlockStmt:
+		rewriteBareContinues(s.List, label)
+		return s
+	case *ast.IfStmt:
+		s.Body = rewriteBareContinuesInStmt(s.Body, label).(*ast.BlockStmt)
+		if s.Else != nil {
+			s.Else = rewriteBareContinuesInStmt(s.Else, label)
+		}
+		return s
+	case *ast.LabeledStmt:
+		s.Stmt = rewriteBareContinuesInStmt(s.Stmt, label)
+		return s
+	case *ast.SwitchStmt:
+		for _, cc := range s.Body.List {
+			rewriteBareContinues(cc.(*ast.CaseClause).Body, label)
+		}
+		return s
+	case *ast.TypeSwitchStmt:
+		for _, cc := range s.Body.List {
+			rewriteBareContinues(cc.(*ast.CaseClause).Body, label)
+		}
+		return s
+	case *ast.SelectStmt:
+		for _, cc := range s.Body.List {
+			rewriteBareContinues(cc.(*ast.CommClause).Body, label)
+		}
+		return s
+	default:
+		// *ast.ForStmt and *ast.RangeStmt are left untouched: their own
+		// unlabeled continues already target themselves, not label.
+		return s
+	}
+}
@@ -0,0 +1,222 @@
+package astrewrite
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+)
+
+// Aspect describes where to inject Before/After advice and what to inject.
+// Exactly one of the pointcut fields (FuncName, CallName) should be set:
+// FuncName matches function declarations by name, CallName matches call
+// sites by the name of the called function.
+type Aspect struct {
+	FuncName *regexp.Regexp
+	CallName *regexp.Regexp
+
+	// Before/After are statement lists run before/after the matched
+	// function body or call. They may reference the pointcut's metavariables
+	// ($fn for the function/call name, $args for its arguments, $ret for its
+	// results) via ast.Ident nodes with those names; Weave substitutes them
+	// like Rewrite does for rule templates.
+	Before []ast.Stmt
+	After  []ast.Stmt
+}
+
+// Weave applies aspects to file, injecting Before/After advice around
+// matching function bodies and call sites. It reuses the traversal skeleton
+// from Simplify/Rewrite and keeps info's Scopes/Types/Uses maps consistent
+// for any freshly introduced identifiers.
+func Weave(file *ast.File, info *types.Info, aspects []Aspect) *ast.File {
+	c := &weaveContext{info: info, aspects: aspects}
+	decls := make([]ast.Decl, len(file.Decls))
+	for i, decl := range file.Decls {
+		c.varCounter = 0
+		decls[i] = c.weaveDecl(decl)
+	}
+	newFile := &ast.File{
+		Doc:        file.Doc,
+		Package:    file.Package,
+		Name:       file.Name,
+		Decls:      decls,
+		Scope:      file.Scope,
+		Imports:    file.Imports,
+		Unresolved: file.Unresolved,
+		Comments:   file.Comments,
+	}
+	c.info.Scopes[newFile] = c.info.Scopes[file]
+	return newFile
+}
+
+type weaveContext struct {
+	info       *types.Info
+	aspects    []Aspect
+	varCounter int
+}
+
+func (c *weaveContext) weaveDecl(decl ast.Decl) ast.Decl {
+	fd, ok := decl.(*ast.FuncDecl)
+	if !ok {
+		return decl
+	}
+	newFd := *fd
+	newFd.Body = c.weaveBlock(fd.Body)
+
+	for _, a := range c.aspects {
+		if a.FuncName == nil || !a.FuncName.MatchString(fd.Name.Name) {
+			continue
+		}
+		binds := map[string]ast.Expr{"$fn": ast.NewIdent(fd.Name.Name)}
+		before := instantiateStmts(a.Before, binds)
+		after := instantiateStmts(a.After, binds)
+		body := newFd.Body.List
+		if len(after) != 0 {
+			body = append([]ast.Stmt{&ast.DeferStmt{
+				Call: &ast.CallExpr{
+					Fun: &ast.FuncLit{Type: &ast.FuncType{Params: &ast.FieldList{}}, Body: &ast.BlockStmt{List: after}},
+				},
+			}}, body...)
+		}
+		newFd.Body.List = append(before, body...)
+	}
+	return &newFd
+}
+
+func (c *weaveContext) weaveBlock(b *ast.BlockStmt) *ast.BlockStmt {
+	if b == nil {
+		return nil
+	}
+	newB := &ast.BlockStmt{Lbrace: b.Lbrace, Rbrace: b.Rbrace}
+	for _, s := range b.List {
+		c.weaveStmt(&newB.List, s)
+	}
+	c.info.Scopes[newB] = c.info.Scopes[b]
+	return newB
+}
+
+func (c *weaveContext) weaveStmt(out *[]ast.Stmt, s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		*out = append(*out, &ast.ExprStmt{X: c.weaveExpr(out, s.X)})
+	case *ast.BlockStmt:
+		*out = append(*out, c.weaveBlock(s))
+	case *ast.AssignStmt:
+		newS := *s
+		rhs := make([]ast.Expr, len(s.Rhs))
+		for i, x := range s.Rhs {
+			rhs[i] = c.weaveExpr(out, x)
+		}
+		newS.Rhs = rhs
+		*out = append(*out, &newS)
+	case *ast.ReturnStmt:
+		results := make([]ast.Expr, len(s.Results))
+		for i, x := range s.Results {
+			results[i] = c.weaveExpr(out, x)
+		}
+		*out = append(*out, &ast.ReturnStmt{Return: s.Return, Results: results})
+	default:
+		*out = append(*out, s)
+	}
+}
+
+// weaveExpr replaces x, if it's a call site matching a CallName pointcut,
+// with a block-valued rewrite: fresh idents bind the args, Before runs,
+// the original call is invoked capturing its results into fresh idents,
+// After runs, and the result ident(s) become the replacement expression.
+// Non-matching expressions are returned unchanged (calls within them are
+// not woven; only top-level call sites are matched, mirroring the pointcut
+// granularity Aspect documents).
+func (c *weaveContext) weaveExpr(out *[]ast.Stmt, x ast.Expr) ast.Expr {
+	call, ok := x.(*ast.CallExpr)
+	if !ok {
+		return x
+	}
+	name := calleeName(call.Fun, c.info)
+	for _, a := range c.aspects {
+		if a.CallName == nil || !a.CallName.MatchString(name) {
+			continue
+		}
+
+		argIdents := make([]ast.Expr, len(call.Args))
+		for i, arg := range call.Args {
+			id := c.newIdent()
+			*out = append(*out, simpleAssign(id, token.DEFINE, arg))
+			argIdents[i] = id
+		}
+		binds := map[string]ast.Expr{"$fn": ast.NewIdent(name)}
+		if len(argIdents) > 0 {
+			binds["$args"] = argIdents[0]
+		}
+
+		*out = append(*out, instantiateStmts(a.Before, binds)...)
+
+		retID := c.newIdent()
+		*out = append(*out, simpleAssign(retID, token.DEFINE, &ast.CallExpr{
+			Fun:      call.Fun,
+			Args:     argIdents,
+			Ellipsis: call.Ellipsis,
+		}))
+		binds["$ret"] = retID
+
+		*out = append(*out, instantiateStmts(a.After, binds)...)
+		return retID
+	}
+	return x
+}
+
+func (c *weaveContext) newIdent() *ast.Ident {
+	c.varCounter++
+	id := ast.NewIdent(gensymName(c.varCounter))
+	c.info.Types[id] = types.TypeAndValue{}
+	return id
+}
+
+func gensymName(n int) string {
+	return "_w" + itoa(n)
+}
+
+func itoa(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	var digits []byte
+	for n > 0 {
+		digits = append([]byte{byte('0' + n%10)}, digits...)
+		n /= 10
+	}
+	return string(digits)
+}
+
+// instantiateStmts substitutes metavariable identifiers in stmts' expressions
+// according to binds. Only plain expression/return/assign statements made of
+// metavariable references are substituted; anything else is copied as-is,
+// which is sufficient for the small Before/After templates aspects use.
+func instantiateStmts(stmts []ast.Stmt, binds map[string]ast.Expr) []ast.Stmt {
+	out := make([]ast.Stmt, len(stmts))
+	for i, s := range stmts {
+		switch s := s.(type) {
+		case *ast.ExprStmt:
+			out[i] = &ast.ExprStmt{X: instantiateExpr(s.X, binds)}
+		default:
+			out[i] = s
+		}
+	}
+	return out
+}
+
+func instantiateExpr(x ast.Expr, binds map[string]ast.Expr) ast.Expr {
+	if name, ok := isMetaVar(x); ok {
+		if bound, ok := binds[name]; ok {
+			return bound
+		}
+	}
+	if call, ok := x.(*ast.CallExpr); ok {
+		args := make([]ast.Expr, len(call.Args))
+		for i, a := range call.Args {
+			args[i] = instantiateExpr(a, binds)
+		}
+		return &ast.CallExpr{Fun: call.Fun, Args: args, Ellipsis: call.Ellipsis}
+	}
+	return x
+}
@@ -0,0 +1,74 @@
+package sops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// DefaultMACAlgorithm is the algorithm used to compute a Tree's MAC when its
+// Metadata.MACAlgorithm is empty, which includes every file written before
+// Metadata.MACAlgorithm existed. It reproduces the exact digest SOPS has
+// always computed -- an unkeyed SHA-512 over the tree's content -- so that
+// those files keep verifying correctly; it is not a real HMAC despite the
+// name, which only exists to give that legacy behavior a selectable identity
+// in the registry. For a real data-key-keyed HMAC-SHA512, register
+// Metadata.MACAlgorithm as "HMAC-SHA512-KEYED" instead.
+const DefaultMACAlgorithm = "HMAC-SHA512"
+
+// MACAlgorithmFactory returns a new hash.Hash that computes a Tree's MAC,
+// keyed with the Tree's data key where the underlying algorithm supports it.
+type MACAlgorithmFactory func(dataKey []byte) hash.Hash
+
+// macAlgorithms holds the MAC algorithms registered with
+// RegisterMACAlgorithm, keyed by the name stored in Metadata.MACAlgorithm.
+var macAlgorithms = map[string]MACAlgorithmFactory{}
+
+func init() {
+	RegisterMACAlgorithm(DefaultMACAlgorithm, func(dataKey []byte) hash.Hash {
+		return sha512.New()
+	})
+	// HMAC-SHA512-KEYED is a real, data-key-keyed HMAC-SHA512, unlike
+	// DefaultMACAlgorithm's unkeyed legacy digest of the same hash function.
+	RegisterMACAlgorithm("HMAC-SHA512-KEYED", func(dataKey []byte) hash.Hash {
+		return hmac.New(sha512.New, dataKey)
+	})
+	RegisterMACAlgorithm("HMAC-SHA256", func(dataKey []byte) hash.Hash {
+		return hmac.New(sha256.New, dataKey)
+	})
+	RegisterMACAlgorithm("BLAKE2b", func(dataKey []byte) hash.Hash {
+		h, err := blake2b.New512(dataKey)
+		if err != nil {
+			// blake2b.New512 only rejects keys longer than 64 bytes, which
+			// SOPS data keys never are.
+			panic(err)
+		}
+		return h
+	})
+}
+
+// RegisterMACAlgorithm registers factory under name, so that a Tree whose
+// Metadata.MACAlgorithm is name computes and verifies its MAC with it. It is
+// meant to be called from an init() function, before any Tree using it is
+// encrypted or decrypted.
+func RegisterMACAlgorithm(name string, factory MACAlgorithmFactory) {
+	macAlgorithms[name] = factory
+}
+
+// macHash returns a new hash.Hash for the Metadata's MACAlgorithm, keyed with
+// dataKey, or for DefaultMACAlgorithm if MACAlgorithm is unset.
+func (m Metadata) macHash(dataKey []byte) (hash.Hash, error) {
+	name := m.MACAlgorithm
+	if name == "" {
+		name = DefaultMACAlgorithm
+	}
+	factory, ok := macAlgorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown MAC algorithm %q", name)
+	}
+	return factory(dataKey), nil
+}
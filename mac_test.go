@@ -0,0 +1,56 @@
+package sops
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMacHashDefaultsToDefaultMACAlgorithm(t *testing.T) {
+	m := Metadata{}
+	hash, err := m.macHash(bytes.Repeat([]byte{'f'}, 32))
+	assert.NoError(t, err)
+	assert.NotNil(t, hash)
+
+	defaultHash, err := (Metadata{MACAlgorithm: DefaultMACAlgorithm}).macHash(bytes.Repeat([]byte{'f'}, 32))
+	assert.NoError(t, err)
+	hash.Write([]byte("foo"))
+	defaultHash.Write([]byte("foo"))
+	assert.Equal(t, defaultHash.Sum(nil), hash.Sum(nil))
+}
+
+func TestMacHashUnknownAlgorithm(t *testing.T) {
+	m := Metadata{MACAlgorithm: "not-a-real-algorithm"}
+	_, err := m.macHash(bytes.Repeat([]byte{'f'}, 32))
+	assert.Error(t, err)
+}
+
+func TestTreeEncryptDecryptRoundTripPerMACAlgorithm(t *testing.T) {
+	for name := range macAlgorithms {
+		t.Run(name, func(t *testing.T) {
+			branches := TreeBranches{
+				TreeBranch{
+					TreeItem{
+						Key:   "foo",
+						Value: "bar",
+					},
+				},
+			}
+			key := bytes.Repeat([]byte{'f'}, 32)
+			tree := Tree{
+				Branches: branches,
+				Metadata: Metadata{
+					UnencryptedSuffix: DefaultUnencryptedSuffix,
+					MACAlgorithm:      name,
+				},
+			}
+			mac, err := tree.Encrypt(key, MockCipher{})
+			assert.NoError(t, err)
+
+			computedMac, err := tree.Decrypt(key, MockCipher{})
+			assert.NoError(t, err)
+			assert.Equal(t, mac, computedMac)
+		})
+	}
+}
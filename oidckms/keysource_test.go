@@ -0,0 +1,72 @@
+package oidckms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMasterKey(t *testing.T) {
+	k := NewMasterKey("https://kms.example.com", "my-key", "https://issuer.example.com", "sops", "/var/run/secrets/token")
+	assert.Equal(t, "https://kms.example.com", k.Endpoint)
+	assert.Equal(t, "my-key", k.KeyName)
+	assert.Equal(t, "https://issuer.example.com", k.Issuer)
+	assert.Equal(t, "sops", k.Audience)
+	assert.Equal(t, "/var/run/secrets/token", k.TokenFile)
+	assert.WithinDuration(t, time.Now().UTC(), k.CreationDate, 5*time.Second)
+}
+
+func TestMasterKey_ToString(t *testing.T) {
+	k := NewMasterKey("https://kms.example.com", "my-key", "", "", "")
+	assert.Equal(t, "https://kms.example.com/my-key", k.ToString())
+}
+
+func TestMasterKey_ToMap(t *testing.T) {
+	k := NewMasterKey("https://kms.example.com", "my-key", "https://issuer.example.com", "sops", "/token")
+	k.EncryptedKey = "encrypted_data"
+	m := k.ToMap()
+
+	assert.Equal(t, "https://kms.example.com", m["endpoint"])
+	assert.Equal(t, "my-key", m["key_name"])
+	assert.Equal(t, "https://issuer.example.com", m["issuer"])
+	assert.Equal(t, "sops", m["audience"])
+	assert.Equal(t, "encrypted_data", m["enc"])
+	assert.NotEmpty(t, m["created_at"])
+}
+
+func TestMasterKey_NeedsRotation(t *testing.T) {
+	k := NewMasterKey("https://kms.example.com", "my-key", "", "", "")
+	assert.False(t, k.NeedsRotation())
+
+	k.CreationDate = k.CreationDate.Add(-(oidcTTL + time.Second))
+	assert.True(t, k.NeedsRotation())
+}
+
+func TestMasterKey_EncryptedDataKeyRoundTrip(t *testing.T) {
+	k := NewMasterKey("https://kms.example.com", "my-key", "", "", "")
+	k.SetEncryptedDataKey([]byte("enc"))
+	assert.Equal(t, []byte("enc"), k.EncryptedDataKey())
+}
+
+func TestJWKS_PublicKey(t *testing.T) {
+	keys := &jwks{}
+	keys.Keys = append(keys.Keys, struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}{
+		Kid: "key-1",
+		Kty: "RSA",
+		N:   "AQAB", // not a real modulus, just exercising the decode path
+		E:   "AQAB",
+	})
+
+	pub, err := keys.publicKey("key-1")
+	assert.NoError(t, err)
+	assert.NotNil(t, pub.N)
+
+	_, err = keys.publicKey("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/remoteconfig"
+)
+
+// conditionalValueDefaultKey and conditionalValueConditionsKey are the tree
+// keys that mark a value as a Remote Config conditional value, rather than a
+// plain value to publish as-is. For example:
+//
+//	myParam:
+//	  default: "off"
+//	  conditions:
+//	    ios: "on"
+//	    android: "off"
+//
+// This shape is recognized only here, while building a Remote Config
+// parameter for this destination -- it is not a general sops.Tree/stores
+// construct. In particular: sops has no "conditions" package or expression
+// evaluator, the tree isn't aware of conditions when decrypting or MACing
+// (there's no per-branch MAC; the file's single MAC still covers the whole
+// tree), and there's no `sops eval` subcommand or `--condition key=value`
+// flag. A value shaped like this is simply published as a Remote Config
+// conditional parameter; nothing about how sops stores or decrypts it
+// changes.
+const (
+	conditionalValueDefaultKey    = "default"
+	conditionalValueConditionsKey = "conditions"
+)
+
+// FirebaseRemoteConfigDestination is the Firebase Remote Config implementation
+// of the Destination interface. Keys in the decrypted sops tree are published
+// as Remote Config parameters, optionally under a common key prefix. A value
+// that is a map containing conditionalValueDefaultKey and
+// conditionalValueConditionsKey is published as a conditional parameter,
+// evaluating to a different value per named Remote Config condition -- see
+// the doc comment on those constants for what this does and doesn't cover.
+type FirebaseRemoteConfigDestination struct {
+	projectID string
+	prefix    string
+}
+
+// NewFirebaseRemoteConfigDestination is the constructor for a Firebase Remote
+// Config Destination
+func NewFirebaseRemoteConfigDestination(projectID, prefix string) *FirebaseRemoteConfigDestination {
+	return &FirebaseRemoteConfigDestination{projectID, prefix}
+}
+
+// Path returns the Firebase Remote Config location a file's parameters would
+// be published under
+func (frcd *FirebaseRemoteConfigDestination) Path(fileName string) string {
+	return fmt.Sprintf("firebase://%s/remoteConfig/%s%s", frcd.projectID, frcd.prefix, fileName)
+}
+
+// Returns NotImplementedError
+func (frcd *FirebaseRemoteConfigDestination) Upload(fileContents []byte, fileName string) error {
+	return &NotImplementedError{"Firebase Remote Config does not support uploading encrypted sops files directly. Use UploadUnencrypted instead."}
+}
+
+// UploadUnencrypted publishes the provided data as parameters of the
+// project's Remote Config template, adding frcd.prefix to each key and
+// preserving any existing parameters, conditions and parameter groups.
+func (frcd *FirebaseRemoteConfigDestination) UploadUnencrypted(data map[string]interface{}, fileName string) error {
+	ctx := context.Background()
+
+	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: frcd.projectID})
+	if err != nil {
+		return fmt.Errorf("failed to initialize Firebase app: %w", err)
+	}
+
+	client, err := app.RemoteConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Firebase Remote Config client: %w", err)
+	}
+
+	template, err := client.GetRemoteConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current Remote Config template: %w", err)
+	}
+	if template.Parameters == nil {
+		template.Parameters = map[string]*remoteconfig.Parameter{}
+	}
+
+	for key, value := range data {
+		param, err := buildRemoteConfigParameter(value)
+		if err != nil {
+			return fmt.Errorf("failed to build parameter %s: %w", key, err)
+		}
+		template.Parameters[frcd.prefix+key] = param
+	}
+
+	if _, err := client.PublishTemplate(ctx, template); err != nil {
+		return fmt.Errorf("failed to publish Remote Config template: %w", err)
+	}
+	return nil
+}
+
+// buildRemoteConfigParameter builds the Remote Config parameter for a tree
+// value, treating it as a conditional value when it matches that shape and
+// as a plain default value otherwise.
+func buildRemoteConfigParameter(value interface{}) (*remoteconfig.Parameter, error) {
+	def, conditions, ok := conditionalValue(value)
+	if !ok {
+		jsonValue, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return &remoteconfig.Parameter{
+			DefaultValue: &remoteconfig.ParameterValue{Value: string(jsonValue)},
+		}, nil
+	}
+
+	defaultValue, err := remoteConfigParameterValue(def)
+	if err != nil {
+		return nil, fmt.Errorf("default value: %w", err)
+	}
+
+	conditionalValues := make(map[string]*remoteconfig.ParameterValue, len(conditions))
+	for condition, condValue := range conditions {
+		v, err := remoteConfigParameterValue(condValue)
+		if err != nil {
+			return nil, fmt.Errorf("condition %s: %w", condition, err)
+		}
+		conditionalValues[condition] = v
+	}
+
+	return &remoteconfig.Parameter{
+		DefaultValue:      defaultValue,
+		ConditionalValues: conditionalValues,
+	}, nil
+}
+
+// conditionalValue reports whether value is a tree map representing a Remote
+// Config conditional value (see FirebaseRemoteConfigDestination), returning
+// its default value and per-condition values if so.
+func conditionalValue(value interface{}) (def interface{}, conditions map[string]interface{}, ok bool) {
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		return nil, nil, false
+	}
+	def, hasDefault := m[conditionalValueDefaultKey]
+	rawConditions, hasConditions := m[conditionalValueConditionsKey]
+	if !hasDefault || !hasConditions || len(m) != 2 {
+		return nil, nil, false
+	}
+	conditions, isConditionsMap := rawConditions.(map[string]interface{})
+	if !isConditionsMap {
+		return nil, nil, false
+	}
+	return def, conditions, true
+}
+
+// remoteConfigParameterValue JSON-encodes value into a Remote Config
+// ParameterValue.
+func remoteConfigParameterValue(value interface{}) (*remoteconfig.ParameterValue, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteconfig.ParameterValue{Value: string(jsonValue)}, nil
+}
@@ -0,0 +1,71 @@
+package publish
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFirebaseRemoteConfigDestination(t *testing.T) {
+	dest := NewFirebaseRemoteConfigDestination("my-project", "myapp/")
+	assert.NotNil(t, dest)
+	assert.Equal(t, "my-project", dest.projectID)
+	assert.Equal(t, "myapp/", dest.prefix)
+}
+
+func TestFirebaseRemoteConfigDestination_Path(t *testing.T) {
+	dest := NewFirebaseRemoteConfigDestination("my-project", "myapp/")
+	path := dest.Path("config.yaml")
+	assert.Equal(t, "firebase://my-project/remoteConfig/myapp/config.yaml", path)
+}
+
+func TestFirebaseRemoteConfigDestination_Upload(t *testing.T) {
+	dest := NewFirebaseRemoteConfigDestination("my-project", "")
+	err := dest.Upload([]byte("test content"), "test.yaml")
+
+	// Should return NotImplementedError
+	assert.NotNil(t, err)
+	assert.IsType(t, &NotImplementedError{}, err)
+	assert.Contains(t, err.Error(), "Firebase Remote Config does not support uploading encrypted sops files directly")
+}
+
+func TestBuildRemoteConfigParameter_PlainValue(t *testing.T) {
+	param, err := buildRemoteConfigParameter("on")
+	assert.NoError(t, err)
+	assert.Equal(t, `"on"`, param.DefaultValue.Value)
+	assert.Empty(t, param.ConditionalValues)
+}
+
+func TestBuildRemoteConfigParameter_ConditionalValue(t *testing.T) {
+	value := map[string]interface{}{
+		"default": "off",
+		"conditions": map[string]interface{}{
+			"ios":     "on",
+			"android": "off",
+		},
+	}
+
+	param, err := buildRemoteConfigParameter(value)
+	assert.NoError(t, err)
+	assert.Equal(t, `"off"`, param.DefaultValue.Value)
+	assert.Equal(t, `"on"`, param.ConditionalValues["ios"].Value)
+	assert.Equal(t, `"off"`, param.ConditionalValues["android"].Value)
+}
+
+func TestConditionalValue_NotAMatch(t *testing.T) {
+	// Missing "conditions" key: treated as a plain value, not a conditional one.
+	_, _, ok := conditionalValue(map[string]interface{}{"default": "off"})
+	assert.False(t, ok)
+
+	// Extra keys beyond default/conditions: treated as a plain value.
+	_, _, ok = conditionalValue(map[string]interface{}{
+		"default":    "off",
+		"conditions": map[string]interface{}{"ios": "on"},
+		"extra":      "field",
+	})
+	assert.False(t, ok)
+
+	// Not a map at all.
+	_, _, ok = conditionalValue("off")
+	assert.False(t, ok)
+}
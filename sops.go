@@ -38,7 +38,6 @@ package sops // import "github.com/getsops/sops/v3"
 
 import (
 	"crypto/rand"
-	"crypto/sha512"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -109,6 +108,22 @@ type Cipher interface {
 	Decrypt(ciphertext string, key []byte, additionalData string) (plaintext interface{}, err error)
 }
 
+// StreamingCipher encrypts and decrypts a stream of fixed-size chunks, each
+// authenticated independently, so that payloads too large to hold in memory
+// as a single Tree can be encrypted and decrypted a chunk at a time with
+// EncryptStream and DecryptStream.
+type StreamingCipher interface {
+	// EncryptChunk encrypts chunk with key, binding the result to
+	// additionalData and to seqNum, the chunk's position in the stream.
+	EncryptChunk(chunk []byte, key []byte, additionalData string, seqNum uint64) (ciphertext []byte, err error)
+	// DecryptChunk decrypts chunk, returning an error if it was not
+	// encrypted with key for this exact additionalData and seqNum. Binding
+	// the nonce to seqNum means a chunk that has been reordered, duplicated
+	// or substituted from elsewhere in the stream fails authentication
+	// instead of being silently accepted out of order.
+	DecryptChunk(chunk []byte, key []byte, additionalData string, seqNum uint64) (plaintext []byte, err error)
+}
+
 // Comment represents a comment in the sops tree for the file formats that actually support them.
 type Comment struct {
 	Value string
@@ -523,7 +538,10 @@ func (tree Tree) Encrypt(key []byte, cipher Cipher) (string, error) {
 	audit.SubmitEvent(audit.EncryptEvent{
 		File: tree.FilePath,
 	})
-	hash := sha512.New()
+	hash, err := tree.Metadata.macHash(key)
+	if err != nil {
+		return "", err
+	}
 	if tree.Metadata.MACOnlyEncrypted {
 		// We initialize with known set of bytes so that a MAC with this setting
 		// enabled is always different from a MAC with this setting disabled.
@@ -586,7 +604,10 @@ func (tree Tree) Decrypt(key []byte, cipher Cipher) (string, error) {
 	audit.SubmitEvent(audit.DecryptEvent{
 		File: tree.FilePath,
 	})
-	hash := sha512.New()
+	hash, err := tree.Metadata.macHash(key)
+	if err != nil {
+		return "", err
+	}
 	if tree.Metadata.MACOnlyEncrypted {
 		// We initialize with known set of bytes so that a MAC with this setting
 		// enabled is always different from a MAC with this setting disabled.
@@ -673,14 +694,40 @@ type Metadata struct {
 	UnencryptedCommentRegex   string
 	EncryptedCommentRegex     string
 	MessageAuthenticationCode string
-	MACOnlyEncrypted          bool
-	Version                   string
-	KeyGroups                 []KeyGroup
+	// MACAlgorithm is the name of the algorithm, as registered with
+	// RegisterMACAlgorithm, used to compute MessageAuthenticationCode. An
+	// empty value is treated as DefaultMACAlgorithm, so files written before
+	// this field existed keep verifying with the digest they were created
+	// with.
+	MACAlgorithm     string
+	MACOnlyEncrypted bool
+	Version          string
+	KeyGroups        []KeyGroup
 	// ShamirThreshold is the number of key groups required to recover the
 	// original data key
 	ShamirThreshold int
 	// DataKey caches the decrypted data key so it doesn't have to be decrypted with a master key every time it's needed
 	DataKey []byte
+	// Stream holds the parameters needed to decrypt a file that was
+	// encrypted in streaming mode with EncryptStream, rather than as a
+	// single pass over a Tree. It is nil for files encrypted the normal way.
+	Stream *StreamMetadata
+}
+
+// StreamMetadata holds the parameters EncryptStream needs to record so that
+// DecryptStream can later decrypt the same file without loading it into
+// memory all at once.
+type StreamMetadata struct {
+	// FileNonce is the random nonce generated once per encrypted stream,
+	// which the StreamingCipher mixes with each chunk's sequence number to
+	// derive that chunk's AES-GCM nonce.
+	FileNonce []byte
+	// ChunkSize is the size, in bytes, of each plaintext chunk EncryptStream
+	// read from the input before encrypting it.
+	ChunkSize int
+	// TotalSize is the total size, in bytes, of the stream's decrypted
+	// plaintext, used by DecryptStream to detect a truncated file.
+	TotalSize int64
 }
 
 // KeyGroup is a slice of SOPS MasterKeys that all encrypt the same part of the data key
@@ -825,6 +872,27 @@ func (m *Metadata) UpdateMasterKeys(dataKey []byte) (errs []error) {
 // GetDataKeyWithKeyServices retrieves the data key, asking KeyServices to decrypt it with each
 // MasterKey in the Metadata's KeySources until one of them succeeds.
 func (m *Metadata) GetDataKeyWithKeyServices(svcs []keyservice.KeyServiceClient, decryptionOrder []string) ([]byte, error) {
+	return m.GetDataKeyWithKeyServicesAndQuorum(svcs, decryptionOrder, 1)
+}
+
+// GetDataKeyWithKeyServicesAndQuorum retrieves the data key the same way
+// GetDataKeyWithKeyServices does, except that each MasterKey's encrypted data
+// is decrypted by querying every key service in svcs in parallel, and the
+// result is only accepted once keyServiceQuorum of them return the same
+// plaintext. A keyServiceQuorum of 1 or less reproduces the behaviour of
+// GetDataKeyWithKeyServices, returning as soon as any single key service
+// succeeds. It is equivalent to calling
+// GetDataKeyWithKeyServicesQuorumAndConcurrency with an unbounded concurrency.
+func (m *Metadata) GetDataKeyWithKeyServicesAndQuorum(svcs []keyservice.KeyServiceClient, decryptionOrder []string, keyServiceQuorum int) ([]byte, error) {
+	return m.GetDataKeyWithKeyServicesQuorumAndConcurrency(svcs, decryptionOrder, keyServiceQuorum, 0)
+}
+
+// GetDataKeyWithKeyServicesQuorumAndConcurrency retrieves the data key the
+// same way GetDataKeyWithKeyServicesAndQuorum does, except that within each
+// KeyGroup, at most concurrency MasterKeys are queried at once. A concurrency
+// of less than 1 means unbounded, querying every MasterKey in the group at
+// the same time.
+func (m *Metadata) GetDataKeyWithKeyServicesQuorumAndConcurrency(svcs []keyservice.KeyServiceClient, decryptionOrder []string, keyServiceQuorum int, concurrency int) ([]byte, error) {
 	if m.DataKey != nil {
 		return m.DataKey, nil
 	}
@@ -834,7 +902,7 @@ func (m *Metadata) GetDataKeyWithKeyServices(svcs []keyservice.KeyServiceClient,
 	}
 	var parts [][]byte
 	for i, group := range m.KeyGroups {
-		part, err := decryptKeyGroup(group, svcs, decryptionOrder)
+		part, err := decryptKeyGroup(group, svcs, decryptionOrder, keyServiceQuorum, concurrency)
 		if err == nil {
 			parts = append(parts, part)
 		}
@@ -862,23 +930,70 @@ func (m *Metadata) GetDataKeyWithKeyServices(svcs []keyservice.KeyServiceClient,
 }
 
 // decryptKeyGroup tries to decrypt the contents of the provided KeyGroup with
-// any of the MasterKeys in the KeyGroup with any of the provided key services,
-// returning as soon as one key service succeeds.
-func decryptKeyGroup(group KeyGroup, svcs []keyservice.KeyServiceClient, decryptionOrder []string) ([]byte, error) {
-	var keyErrs []error
-	// Sort MasterKeys in the group so we try them in specific order
+// any of the MasterKeys in the KeyGroup with any of the provided key
+// services. Every MasterKey in the group is queried in parallel, since
+// waiting on each one in turn would otherwise make decryption as slow as the
+// sum of all of them (for example KMS, Vault, PGP and age master keys in the
+// same group, each with its own network round trip); as soon as one of them
+// succeeds, its result is returned and a shared context is canceled so the
+// MasterKeys still in flight can stop, instead of this call being bounded by
+// the slowest one of them (for example an unreachable KMS endpoint). At most
+// concurrency MasterKeys are queried at once; concurrency less than 1 means
+// unbounded.
+func decryptKeyGroup(group KeyGroup, svcs []keyservice.KeyServiceClient, decryptionOrder []string, keyServiceQuorum int, concurrency int) ([]byte, error) {
+	// Sort MasterKeys in the group so we prefer results in specific order
 	// Use sorted indices to avoid group slice modification
 	indices := sortKeyGroupIndices(group, decryptionOrder)
-	for _, indexVal := range indices {
-		key := group[indexVal]
-		part, err := decryptKey(key, svcs)
+	if concurrency < 1 {
+		concurrency = len(indices)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type keyResult struct {
+		pos  int
+		part []byte
+		err  error
+	}
+	// jobs is pre-loaded and closed up front so the concurrency-bounded
+	// workers below start immediately and run alongside the result loop,
+	// rather than this function having to finish dispatching every
+	// MasterKey before it can notice and act on an early success.
+	jobs := make(chan int, len(indices))
+	for pos := range indices {
+		jobs <- pos
+	}
+	close(jobs)
+
+	results := make(chan keyResult, len(indices))
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			for pos := range jobs {
+				part, err := decryptKey(ctx, group[indices[pos]], svcs, keyServiceQuorum)
+				results <- keyResult{pos: pos, part: part, err: err}
+			}
+		}()
+	}
+
+	keyErrs := make([]error, len(indices))
+	for received := 0; received < len(indices); received++ {
+		res := <-results
+		if res.err != nil {
+			keyErrs[res.pos] = res.err
+			continue
+		}
+		cancel()
+		return res.part, nil
+	}
+
+	errs := make([]error, 0, len(keyErrs))
+	for _, err := range keyErrs {
 		if err != nil {
-			keyErrs = append(keyErrs, err)
-		} else {
-			return part, nil
+			errs = append(errs, err)
 		}
 	}
-	return nil, decryptKeyErrors(keyErrs)
+	return nil, decryptKeyErrors(errs)
 }
 
 // sortKeyGroupIndices returns indices that would sort the KeyGroup
@@ -912,36 +1027,67 @@ func sortKeyGroupIndices(group KeyGroup, decryptionOrder []string) []int {
 	return indices
 }
 
-// decryptKey tries to decrypt the contents of the provided MasterKey with any
-// of the key services, returning as soon as one key service succeeds.
-func decryptKey(key keys.MasterKey, svcs []keyservice.KeyServiceClient) ([]byte, error) {
+// decryptKey queries every one of the given key services in parallel for the
+// plaintext of key's encrypted data, and accepts the result as soon as
+// keyServiceQuorum of them agree on the same plaintext. A keyServiceQuorum of
+// 1 or less returns as soon as any single key service succeeds, matching the
+// historical behaviour of trying key services one at a time. Querying in
+// parallel keeps decryption latency bounded by the slowest key service that's
+// actually needed to reach quorum, rather than the sum of all of them; once
+// quorum is reached, the shared context is canceled so key services that
+// honor context cancellation can stop instead of running to completion for a
+// result that's no longer needed. parentCtx is derived from, rather than
+// replaced by, a context.WithCancel of its own, so that a caller racing
+// decryptKey against other MasterKeys (see decryptKeyGroup) can cancel
+// parentCtx to stop this MasterKey's still-pending key service calls too.
+func decryptKey(parentCtx context.Context, key keys.MasterKey, svcs []keyservice.KeyServiceClient, keyServiceQuorum int) ([]byte, error) {
+	if keyServiceQuorum < 1 {
+		keyServiceQuorum = 1
+	}
 	svcKey := keyservice.KeyFromMasterKey(key)
-	var part []byte
 	decryptErr := decryptKeyError{
 		keyName: key.ToString(),
 	}
-	for _, svc := range svcs {
-		// All keys in a key group encrypt the same part, so as soon
-		// as we decrypt it successfully with one key, we need to
-		// proceed with the next group
-		var err error
-		if part == nil {
-			var rsp *keyservice.DecryptResponse
-			rsp, err = svc.Decrypt(
-				context.Background(),
+
+	ctx, cancel := context.WithCancel(parentCtx)
+	defer cancel()
+
+	type svcResult struct {
+		i    int
+		part []byte
+		err  error
+	}
+	results := make(chan svcResult, len(svcs))
+	for i, svc := range svcs {
+		go func(i int, svc keyservice.KeyServiceClient) {
+			rsp, err := svc.Decrypt(
+				ctx,
 				&keyservice.DecryptRequest{
 					Ciphertext: key.EncryptedDataKey(),
 					Key:        &svcKey,
 				})
-			if err == nil {
-				part = rsp.Plaintext
+			if err != nil {
+				results <- svcResult{i: i, err: err}
+				return
 			}
-		}
-		decryptErr.errs = append(decryptErr.errs, err)
+			results <- svcResult{i: i, part: rsp.Plaintext}
+		}(i, svc)
 	}
-	if part != nil {
-		return part, nil
+
+	errs := make([]error, len(svcs))
+	votes := make(map[string]int, len(svcs))
+	for received := 0; received < len(svcs); received++ {
+		res := <-results
+		if res.err != nil {
+			errs[res.i] = res.err
+			continue
+		}
+		votes[string(res.part)]++
+		if votes[string(res.part)] >= keyServiceQuorum {
+			return res.part, nil
+		}
 	}
+	decryptErr.errs = errs
 	return nil, &decryptErr
 }
 
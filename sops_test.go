@@ -8,9 +8,12 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 
 	"github.com/getsops/sops/v3/age"
 	"github.com/getsops/sops/v3/hcvault"
+	"github.com/getsops/sops/v3/keyservice"
 	"github.com/getsops/sops/v3/pgp"
 )
 
@@ -1606,3 +1609,62 @@ func TestSortKeyGroupIndices(t *testing.T) {
 		assert.Equal(t, expected, indices)
 	})
 }
+
+// mockKeyServiceClient is a keyservice.KeyServiceClient that always decrypts
+// to plaintext, or always fails if plaintext is nil.
+type mockKeyServiceClient struct {
+	plaintext []byte
+}
+
+func (m mockKeyServiceClient) Encrypt(ctx context.Context, req *keyservice.EncryptRequest, opts ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (m mockKeyServiceClient) Decrypt(ctx context.Context, req *keyservice.DecryptRequest, opts ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	if m.plaintext == nil {
+		return nil, fmt.Errorf("mock decrypt failure")
+	}
+	return &keyservice.DecryptResponse{Plaintext: m.plaintext}, nil
+}
+
+func TestDecryptKeyQuorum(t *testing.T) {
+	key := &pgp.MasterKey{EncryptedKey: "encrypted"}
+
+	t.Run("default quorum accepts the first success", func(t *testing.T) {
+		svcs := []keyservice.KeyServiceClient{
+			mockKeyServiceClient{plaintext: nil},
+			mockKeyServiceClient{plaintext: []byte("data")},
+		}
+		part, err := decryptKey(key, svcs, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("data"), part)
+	})
+
+	t.Run("quorum of two requires two services to agree", func(t *testing.T) {
+		svcs := []keyservice.KeyServiceClient{
+			mockKeyServiceClient{plaintext: []byte("data")},
+			mockKeyServiceClient{plaintext: []byte("data")},
+			mockKeyServiceClient{plaintext: nil},
+		}
+		part, err := decryptKey(key, svcs, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("data"), part)
+	})
+
+	t.Run("quorum of two fails when services disagree", func(t *testing.T) {
+		svcs := []keyservice.KeyServiceClient{
+			mockKeyServiceClient{plaintext: []byte("data")},
+			mockKeyServiceClient{plaintext: []byte("other")},
+		}
+		_, err := decryptKey(key, svcs, 2)
+		assert.Error(t, err)
+	})
+
+	t.Run("quorum larger than the number of services always fails", func(t *testing.T) {
+		svcs := []keyservice.KeyServiceClient{
+			mockKeyServiceClient{plaintext: []byte("data")},
+		}
+		_, err := decryptKey(key, svcs, 2)
+		assert.Error(t, err)
+	})
+}
@@ -49,6 +49,7 @@ type Metadata struct {
 	AgeKeys                   []agekey    `yaml:"age" json:"age" mapstructure:"age"`
 	LastModified              string      `yaml:"lastmodified" json:"lastmodified" mapstructure:"lastmodified"`
 	MessageAuthenticationCode string      `yaml:"mac" json:"mac" mapstructure:"mac"`
+	MACAlgorithm              string      `yaml:"mac_algorithm,omitempty" json:"mac_algorithm,omitempty" mapstructure:"mac_algorithm,omitempty"`
 	PGPKeys                   []pgpkey    `yaml:"pgp" json:"pgp" mapstructure:"pgp"`
 	UnencryptedSuffix         string      `yaml:"unencrypted_suffix,omitempty" json:"unencrypted_suffix,omitempty" mapstructure:"unencrypted_suffix,omitempty"`
 	EncryptedSuffix           string      `yaml:"encrypted_suffix,omitempty" json:"encrypted_suffix,omitempty" mapstructure:"encrypted_suffix,omitempty"`
@@ -117,6 +118,7 @@ func MetadataFromInternal(sopsMetadata sops.Metadata) Metadata {
 	m.UnencryptedRegex = sopsMetadata.UnencryptedRegex
 	m.EncryptedRegex = sopsMetadata.EncryptedRegex
 	m.MessageAuthenticationCode = sopsMetadata.MessageAuthenticationCode
+	m.MACAlgorithm = sopsMetadata.MACAlgorithm
 	m.Version = sopsMetadata.Version
 	m.ShamirThreshold = sopsMetadata.ShamirThreshold
 	if len(sopsMetadata.KeyGroups) == 1 {
@@ -269,6 +271,7 @@ func (m *Metadata) ToInternal() (sops.Metadata, error) {
 		ShamirThreshold:           m.ShamirThreshold,
 		Version:                   m.Version,
 		MessageAuthenticationCode: m.MessageAuthenticationCode,
+		MACAlgorithm:              m.MACAlgorithm,
 		UnencryptedSuffix:         m.UnencryptedSuffix,
 		EncryptedSuffix:           m.EncryptedSuffix,
 		UnencryptedRegex:          m.UnencryptedRegex,
@@ -0,0 +1,127 @@
+package sops
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// lengthPrefixSize is the size, in bytes, of the big-endian chunk length
+// written before every ciphertext chunk in a stream produced by EncryptStream.
+const lengthPrefixSize = 4
+
+// EncryptStream reads plaintext from r in fixed chunkSize pieces, encrypts
+// each chunk with cipher under key and additionalData, and writes the
+// resulting ciphertext chunks to w, each preceded by its length so
+// DecryptStream can read them back one at a time without buffering the
+// whole stream. On success it records fileNonce, chunkSize and the total
+// number of plaintext bytes read into a new StreamMetadata assigned to
+// meta.Stream, and returns the hex-encoded SHA-512 MAC computed
+// incrementally over the ciphertext chunks.
+func EncryptStream(w io.Writer, r io.Reader, cipher StreamingCipher, key []byte, additionalData string, chunkSize int, fileNonce []byte, meta *Metadata) (mac string, err error) {
+	if chunkSize <= 0 {
+		return "", fmt.Errorf("chunk size must be positive, got %d", chunkSize)
+	}
+	hash := sha512.New()
+	buf := make([]byte, chunkSize)
+	var total int64
+	var seqNum uint64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			ciphertext, err := cipher.EncryptChunk(buf[:n], key, additionalData, seqNum)
+			if err != nil {
+				return "", fmt.Errorf("could not encrypt chunk %d: %s", seqNum, err)
+			}
+			if err := writeChunk(w, ciphertext, hash); err != nil {
+				return "", err
+			}
+			total += int64(n)
+			seqNum++
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return "", fmt.Errorf("could not read plaintext stream: %s", readErr)
+		}
+	}
+	meta.Stream = &StreamMetadata{
+		FileNonce: fileNonce,
+		ChunkSize: chunkSize,
+		TotalSize: total,
+	}
+	return fmt.Sprintf("%X", hash.Sum(nil)), nil
+}
+
+// DecryptStream reads the ciphertext chunks written by EncryptStream from r,
+// decrypts each of them in order with cipher under key and additionalData,
+// and writes the resulting plaintext to w. It rejects a stream that is
+// shorter than meta.Stream.TotalSize promises, and DecryptChunk rejects any
+// individual chunk that was reordered, duplicated or tampered with, since
+// its AES-GCM nonce is bound to its expected position in the stream.
+// meta must be the Metadata of a Tree previously encrypted with
+// EncryptStream; it returns an error if meta.Stream is nil.
+func DecryptStream(w io.Writer, r io.Reader, cipher StreamingCipher, key []byte, additionalData string, meta *Metadata) (mac string, err error) {
+	if meta.Stream == nil {
+		return "", fmt.Errorf("tree metadata has no stream information: it was not encrypted in streaming mode")
+	}
+	hash := sha512.New()
+	var total int64
+	var seqNum uint64
+	for {
+		length, readErr := readChunkLength(r)
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", fmt.Errorf("could not read length of chunk %d: %s", seqNum, readErr)
+		}
+		ciphertext := make([]byte, length)
+		if _, err := io.ReadFull(r, ciphertext); err != nil {
+			return "", fmt.Errorf("could not read chunk %d: stream is truncated: %s", seqNum, err)
+		}
+		hash.Write(ciphertext)
+		plaintext, err := cipher.DecryptChunk(ciphertext, key, additionalData, seqNum)
+		if err != nil {
+			return "", fmt.Errorf("could not decrypt chunk %d: %s", seqNum, err)
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return "", fmt.Errorf("could not write plaintext for chunk %d: %s", seqNum, err)
+		}
+		total += int64(len(plaintext))
+		seqNum++
+	}
+	if total != meta.Stream.TotalSize {
+		return "", fmt.Errorf("decrypted %d bytes but expected %d: stream is truncated or was tampered with", total, meta.Stream.TotalSize)
+	}
+	return fmt.Sprintf("%X", hash.Sum(nil)), nil
+}
+
+// writeChunk writes chunk to w preceded by its big-endian length, and feeds
+// chunk into hash so the caller can maintain a running MAC over every chunk
+// written without re-reading them.
+func writeChunk(w io.Writer, chunk []byte, hash io.Writer) error {
+	var lengthPrefix [lengthPrefixSize]byte
+	binary.BigEndian.PutUint32(lengthPrefix[:], uint32(len(chunk)))
+	if _, err := w.Write(lengthPrefix[:]); err != nil {
+		return fmt.Errorf("could not write chunk length: %s", err)
+	}
+	if _, err := w.Write(chunk); err != nil {
+		return fmt.Errorf("could not write chunk: %s", err)
+	}
+	if _, err := hash.Write(chunk); err != nil {
+		return fmt.Errorf("could not update MAC: %s", err)
+	}
+	return nil
+}
+
+// readChunkLength reads the big-endian chunk length written by writeChunk.
+func readChunkLength(r io.Reader) (uint32, error) {
+	var lengthPrefix [lengthPrefixSize]byte
+	if _, err := io.ReadFull(r, lengthPrefix[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(lengthPrefix[:]), nil
+}
@@ -0,0 +1,91 @@
+package sops
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStreamingCipher is a StreamingCipher that tags each chunk with the
+// seqNum it was encrypted for, so tests can exercise EncryptStream and
+// DecryptStream's chunking and sequencing logic without depending on a real
+// AEAD implementation.
+type fakeStreamingCipher struct{}
+
+func (fakeStreamingCipher) EncryptChunk(chunk []byte, key []byte, additionalData string, seqNum uint64) ([]byte, error) {
+	tagged := make([]byte, 8+len(chunk))
+	binary.BigEndian.PutUint64(tagged[:8], seqNum)
+	copy(tagged[8:], chunk)
+	return tagged, nil
+}
+
+func (fakeStreamingCipher) DecryptChunk(chunk []byte, key []byte, additionalData string, seqNum uint64) ([]byte, error) {
+	if len(chunk) < 8 {
+		return nil, fmt.Errorf("chunk too short")
+	}
+	if got := binary.BigEndian.Uint64(chunk[:8]); got != seqNum {
+		return nil, fmt.Errorf("chunk was encrypted for position %d, expected %d", got, seqNum)
+	}
+	return chunk[8:], nil
+}
+
+func TestEncryptDecryptStreamRoundTrip(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("0123456789"), 100) // 1000 bytes
+	var ciphertext bytes.Buffer
+	meta := &Metadata{}
+
+	encMac, err := EncryptStream(&ciphertext, bytes.NewReader(plaintext), fakeStreamingCipher{}, []byte("key"), "path", 64, []byte("nonce"), meta)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, encMac)
+	assert.Equal(t, 64, meta.Stream.ChunkSize)
+	assert.Equal(t, int64(len(plaintext)), meta.Stream.TotalSize)
+	assert.Equal(t, []byte("nonce"), meta.Stream.FileNonce)
+
+	var decrypted bytes.Buffer
+	decMac, err := DecryptStream(&decrypted, &ciphertext, fakeStreamingCipher{}, []byte("key"), "path", meta)
+	assert.NoError(t, err)
+	assert.Equal(t, encMac, decMac)
+	assert.Equal(t, plaintext, decrypted.Bytes())
+}
+
+func TestDecryptStreamWithoutStreamMetadata(t *testing.T) {
+	_, err := DecryptStream(&bytes.Buffer{}, &bytes.Buffer{}, fakeStreamingCipher{}, []byte("key"), "path", &Metadata{})
+	assert.Error(t, err)
+}
+
+func TestDecryptStreamRejectsTruncatedStream(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("x"), 200)
+	var ciphertext bytes.Buffer
+	meta := &Metadata{}
+	_, err := EncryptStream(&ciphertext, bytes.NewReader(plaintext), fakeStreamingCipher{}, []byte("key"), "path", 64, []byte("nonce"), meta)
+	assert.NoError(t, err)
+
+	truncated := bytes.NewReader(ciphertext.Bytes()[:ciphertext.Len()-10])
+	_, err = DecryptStream(&bytes.Buffer{}, truncated, fakeStreamingCipher{}, []byte("key"), "path", meta)
+	assert.Error(t, err)
+}
+
+func TestDecryptStreamRejectsReorderedChunks(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("y"), 200)
+	var ciphertext bytes.Buffer
+	meta := &Metadata{}
+	_, err := EncryptStream(&ciphertext, bytes.NewReader(plaintext), fakeStreamingCipher{}, []byte("key"), "path", 64, []byte("nonce"), meta)
+	assert.NoError(t, err)
+
+	// Swap the first two length-prefixed chunks, simulating a reordering
+	// attack on the ciphertext stream.
+	raw := ciphertext.Bytes()
+	firstLen := binary.BigEndian.Uint32(raw[:4])
+	firstEnd := 4 + int(firstLen)
+	secondLen := binary.BigEndian.Uint32(raw[firstEnd : firstEnd+4])
+	secondEnd := firstEnd + 4 + int(secondLen)
+
+	reordered := append(append([]byte{}, raw[firstEnd:secondEnd]...), raw[:firstEnd]...)
+	reordered = append(reordered, raw[secondEnd:]...)
+
+	_, err = DecryptStream(&bytes.Buffer{}, bytes.NewReader(reordered), fakeStreamingCipher{}, []byte("key"), "path", meta)
+	assert.Error(t, err)
+}